@@ -1,63 +1,138 @@
 package main
 
 import (
-	"github.com/gen2brain/malgo"
+	"errors"
+	"fmt"
 	"github.com/ivkos/luxaudio/internal/analyzers"
 	"github.com/ivkos/luxaudio/internal/audio"
+	"github.com/ivkos/luxaudio/internal/beat"
 	"github.com/ivkos/luxaudio/internal/effects"
 	"github.com/ivkos/luxaudio/internal/led"
 	"github.com/ivkos/luxaudio/internal/utils"
+	"io"
 	"log"
-	"runtime"
+	"math"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
 )
 
+const (
+	noAudioTimeout = 500 * time.Millisecond
+	pulseFadeTime  = 300 * time.Millisecond
+)
+
 func main() {
 	f := utils.GetFlags()
 
-	malgoBackend := getBackend(f.Backend)
-	malgoDevice := getDevice(f.Device)
+	if f.ListDevices {
+		utils.CheckErr(audio.PrintDevices(os.Stdout, f.Backend))
+		return
+	}
 
-	context, captureConfig := initMalgo(uint32(f.Channels), uint32(f.SampleRate), malgoBackend, malgoDevice)
-	defer func() {
-		_ = context.Uninit()
-		context.Free()
-	}()
+	source, err := audio.NewSource(f)
+	utils.CheckErr(err)
 
-	// Create UDP sockets
-	effectConn := utils.GetUDPConn(f.Host, f.Port)
-	pingerConn := utils.GetUDPConn(f.Host, f.Port)
-	defer func() {
-		_ = effectConn.Close()
-		_ = pingerConn.Close()
-	}()
+	var payloadSender analyzers.PayloadSender
+	var pinger *utils.Pinger
 
-	payloadSender := func(ledData []byte) {
-		_, err := effectConn.Write(led.MakeRawModeLuxPayload(uint8(f.LedCount), ledData))
-		utils.CheckErr(err)
+	if f.Offline {
+		if f.Effect == "luxception" {
+			log.Fatalln("The luxception effect requires a luxsrv")
+		}
+
+		payloadSender = func(ledData []byte) {}
+	} else {
+		// Create UDP sockets
+		effectConn := utils.GetUDPConn(f.Host, f.Port)
+		pingerConn := utils.GetUDPConn(f.Host, f.Port)
+		defer func() {
+			_ = effectConn.Close()
+			_ = pingerConn.Close()
+		}()
+
+		pinger = utils.NewPinger(pingerConn, 2*time.Second, f.Verbose)
+
+		payloadSender = func(ledData []byte) {
+			// file input is analyzed while the luxsrv is unreachable too, but there's no point in sending
+			if !pinger.IsReachable {
+				return
+			}
+
+			// a luxsrv that just went away is refused, the pinger will find out on its own
+			_, err := effectConn.Write(led.MakeRawModeLuxPayload(uint8(f.LedCount), ledData))
+			if !errors.Is(err, syscall.ECONNREFUSED) {
+				utils.CheckErr(err)
+			}
+		}
 	}
 
-	pinger := utils.NewPinger(pingerConn, 2*time.Second, f.Verbose)
+	sender := getSender(f, payloadSender)
 
-	analyzer := analyzers.NewSmartAnalyzer(
-		f.FftSize,
-		f.LedCount,
-		float64(f.SampleRate),
-		f.Decay,
-		f.DbfsThreshold,
-		f.AudibleLow,
-		f.AudibleHigh,
-		f.Mirror,
-	)
+	channels := 1
+	if f.Stereo {
+		if source.Channels() < 2 {
+			log.Println("WARN: Stereo mode requires at least 2 channels, falling back to mono")
+		} else if f.LedCount < 2 {
+			log.Println("WARN: Stereo mode requires at least 2 LEDs, falling back to mono")
+		} else {
+			channels = 2
+		}
+	}
+
+	hopSize := getHopSize(f, source.SampleRate())
+	log.Printf("Analysis: %d samples every %d samples, %.1f fps\n",
+		f.FftSize, hopSize, float64(source.SampleRate())/float64(hopSize))
+
+	analyzer := getAnalyzer(f, source.SampleRate(), channels, hopSize)
 
 	effect := getEffect(f, pinger)
 
-	queue := analyzers.NewQueue(f.FftSize, &analyzer, &effect, &payloadSender)
+	filter := getFilter(f, source.SampleRate(), channels)
+
+	gate := getSilenceGate(f, source.SampleRate(), channels)
+
+	agc := getAgc(f, source.SampleRate(), channels)
+
+	detector := getDetector(f, source.SampleRate(), channels, hopSize, effect)
+
+	if f.Analyzer == "meter" {
+		// the red zone depends on the layout of the meter, so it's added to whichever effect colors it
+		zone := analyzers.MeterRedZone(f.LedCount, f.MeterFloor, f.RedZone, f.Mirror, channels == 2)
+		effect = effects.NewRedZoneEffect(effect, zone, f.RedZoneColor)
+	}
+
+	// files and pipes can wait for the analysis, unlike audio devices and the network
+	lossless := f.Input != ""
+
+	queue := analyzers.NewQueue(f.FftSize, hopSize, channels, lossless, &analyzer, &effect, filter, gate, agc, detector, &sender)
+	recorder, downmixRecorder := getRecorders(f, source, channels)
+	defer func() {
+		if recorder != nil {
+			recorder.Close()
+		}
+		if downmixRecorder != nil {
+			downmixRecorder.Close()
+		}
+	}()
+
+	// files are analyzed regardless of the luxsrv, so that the analysis doesn't depend on when it's reachable
+	receiverPinger := pinger
+	if lossless {
+		receiverPinger = nil
+	}
+
 	frameReceiver := audio.NewFrameReceiver(
-		malgo.SampleSizeInBytes(captureConfig.Capture.Format),
-		int(captureConfig.Capture.Channels),
+		source.Format(),
+		source.Channels(),
+		channels,
 		queue,
-		pinger,
+		receiverPinger,
+		recorder,
+		downmixRecorder,
 	)
 
 	if f.Verbose {
@@ -65,104 +140,297 @@ func main() {
 			for {
 				t := time.NewTimer(1 * time.Second)
 				<-t.C
-				log.Printf("len(queue) = %d\n", queue.Size())
+				log.Printf("len(queue) = %d, dropped = %d\n", queue.Size(), queue.Dropped())
+
+				if detector != nil {
+					tempo := detector.Tempo()
+					log.Printf("tempo = %.1f BPM, confidence = %.2f\n", tempo.Bpm, tempo.Confidence)
+				}
 			}
 		}()
 	}
 
+	// analyze silence while no audio arrives at all, e.g. when the audio device was lost or a loopback
+	// device delivers nothing while nothing plays, so that the strip fades out and goes idle like when it's silent
+	go func() {
+		ticker := time.NewTicker(time.Duration(hopSize) * time.Second / time.Duration(source.SampleRate()))
+		for range ticker.C {
+			if frameReceiver.SinceLastReceive() > noAudioTimeout {
+				queue.Idle()
+			}
+		}
+	}()
+
 	log.Println("Listening...")
-	device, err := malgo.InitDevice(context.Context, captureConfig, malgo.DeviceCallbacks{
-		Data: func(_, data []byte, count uint32) { frameReceiver.OnReceive(data, count) },
-	})
+	err = source.Start(frameReceiver.OnReceive)
 	utils.CheckErr(err)
 
-	defer device.Uninit()
+	defer func() { _ = source.Stop() }()
 
-	err = device.Start()
-	utils.CheckErr(err)
+	// return normally on signals, so that recordings get finalized
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case err = <-source.Errors():
+		if err == io.EOF {
+			queue.Drain()
+			log.Println("Input ended")
+			return
+		}
+		utils.CheckErr(err)
 
-	select {}
+	case <-signals:
+		log.Println("Stopping...")
+	}
 }
 
-func initMalgo(channels uint32, sampleRate uint32, backend malgo.Backend, device malgo.DeviceType) (*malgo.AllocatedContext, malgo.DeviceConfig) {
-	ctxConfig := malgo.ContextConfig{}
-	ctxConfig.ThreadPriority = malgo.ThreadPriorityRealtime
+func getRecorders(f utils.FlagsResult, source audio.Source, channels int) (*audio.Recorder, *audio.Recorder) {
+	if f.Record == "" {
+		return nil, nil
+	}
 
-	context, err := malgo.InitContext([]malgo.Backend{backend}, ctxConfig, func(message string) {
-		log.Printf("LOG <%v>\n", message)
-	})
+	recorder, err := audio.NewRecorder(
+		f.Record,
+		source.Format(),
+		source.Channels(),
+		source.SampleRate(),
+		f.RecordMaxSize,
+		f.RecordMaxDuration,
+		f.RecordKeep,
+	)
 	utils.CheckErr(err)
 
-	captureConfig := malgo.DefaultDeviceConfig(device)
-	captureConfig.PerformanceProfile = malgo.LowLatency
-	captureConfig.Capture.Format = malgo.FormatF32
-	captureConfig.SampleRate = sampleRate
-	captureConfig.Capture.Channels = channels
+	if !f.RecordDownmix {
+		return recorder, nil
+	}
+
+	ext := filepath.Ext(f.Record)
+	downmixRecorder, err := audio.NewRecorder(
+		strings.TrimSuffix(f.Record, ext)+".downmix"+ext,
+		audio.FormatF32,
+		channels,
+		source.SampleRate(),
+		f.RecordMaxSize,
+		f.RecordMaxDuration,
+		f.RecordKeep,
+	)
+	utils.CheckErr(err)
 
-	return context, captureConfig
+	return recorder, downmixRecorder
 }
 
-func getEffect(f utils.FlagsResult, pinger *utils.Pinger) effects.Effect {
-	switch f.Effect {
-	case "solid":
-		return effects.NewSolidColorEffect(f.LedCount, f.Color)
+func getSender(f utils.FlagsResult, payloadSender analyzers.PayloadSender) analyzers.PayloadSender {
+	if f.MaxFps <= 0 {
+		if f.Interpolate {
+			log.Println("WARN: Interpolation requires maxFps, sending every analyzed frame instead")
+		}
 
-	case "rainbow":
-		return effects.NewRainbowEffect(f.LedCount, 30)
+		return payloadSender
+	}
 
-	case "luxception":
-		return effects.NewLuxceptionEffect(f.LedCount, f.Color, "0.0.0.0", utils.DefaultPort, pinger)
+	return led.NewScheduler(payloadSender, f.MaxFps, f.Interpolate).Submit
+}
+
+func getHopSize(f utils.FlagsResult, sampleRate int) int {
+	hopSize := f.FftSize
+	if f.Fps > 0 {
+		hopSize = int(math.Round(float64(sampleRate) / f.Fps))
+	} else if f.HopSize > 0 {
+		hopSize = f.HopSize
+	}
+
+	if hopSize > f.FftSize {
+		log.Printf("WARN: Hop size of %d samples exceeds the FFT size, using %d\n", hopSize, f.FftSize)
+		hopSize = f.FftSize
+	}
+
+	if hopSize < 1 {
+		hopSize = 1
+	}
+
+	return hopSize
+}
+
+func getAnalyzer(f utils.FlagsResult, sampleRate int, channels int, hopSize int) analyzers.Analyzer {
+	// decay is given per FFT size, keep it as fast in time when analyzing more often
+	decay := math.Pow(f.Decay, float64(hopSize)/float64(f.FftSize))
+
+	bandScale, err := analyzers.ParseBandScale(f.Bands)
+	utils.CheckErr(err)
+
+	window, err := analyzers.ParseWindow(f.Window, f.KaiserBeta)
+	utils.CheckErr(err)
+
+	var newAnalyzer func(ledCount int, mirror bool) analyzers.Analyzer
+
+	switch f.Analyzer {
+	case "smart":
+		newAnalyzer = func(ledCount int, mirror bool) analyzers.Analyzer {
+			return analyzers.NewSmartAnalyzer(
+				f.FftSize,
+				ledCount,
+				float64(sampleRate),
+				decay,
+				f.DbfsThreshold,
+				f.AudibleLow,
+				f.AudibleHigh,
+				mirror,
+				bandScale,
+				window,
+			)
+		}
+
+	case "mel":
+		newAnalyzer = func(ledCount int, mirror bool) analyzers.Analyzer {
+			return analyzers.NewMelAnalyzer(
+				f.FftSize,
+				ledCount,
+				float64(sampleRate),
+				decay,
+				f.DbfsThreshold,
+				f.AudibleLow,
+				f.AudibleHigh,
+				f.MelFilters,
+				mirror,
+				window,
+			)
+		}
+
+	case "cq":
+		newAnalyzer = func(ledCount int, mirror bool) analyzers.Analyzer {
+			analyzer, err := analyzers.NewConstantQAnalyzer(
+				hopSize,
+				ledCount,
+				float64(sampleRate),
+				decay,
+				f.DbfsThreshold,
+				f.AudibleLow,
+				f.AudibleHigh,
+				f.BinsPerOctave,
+				mirror,
+				window,
+			)
+			utils.CheckErr(err)
+
+			return analyzer
+		}
+
+	case "meter":
+		newAnalyzer = func(ledCount int, mirror bool) analyzers.Analyzer {
+			analyzer, err := analyzers.NewMeterAnalyzer(
+				ledCount,
+				hopSize,
+				float64(sampleRate),
+				f.Meter,
+				f.MeterFloor,
+				mirror,
+			)
+			utils.CheckErr(err)
+
+			return analyzer
+		}
 
 	default:
-		log.Fatalf("Unsupported effect: %s", f.Effect)
+		log.Fatalf("Unsupported analyzer: %s", f.Analyzer)
+	}
+
+	if channels == 2 {
+		analyzer, err := analyzers.NewStereoAnalyzer(f.LedCount, func(ledCount int) analyzers.Analyzer {
+			return newAnalyzer(ledCount, false)
+		})
+		utils.CheckErr(err)
+
+		return analyzer
+	}
+
+	return newAnalyzer(f.LedCount, f.Mirror)
+}
+
+func getSilenceGate(f utils.FlagsResult, sampleRate int, channels int) *analyzers.SilenceGate {
+	if f.SilenceHold == 0 {
 		return nil
 	}
+
+	idleEffect, err := effects.NewIdleEffect(f.IdleEffect, f.LedCount, f.IdleColor)
+	utils.CheckErr(err)
+
+	return analyzers.NewSilenceGate(f.SilenceThreshold, f.SilenceHold, float64(sampleRate), channels, idleEffect, f.FadeTime)
 }
 
-func getBackend(backend string) malgo.Backend {
-	switch backend {
-	case "auto":
-		switch os := runtime.GOOS; os {
-		case "linux":
-			return malgo.BackendAlsa
+func getFilter(f utils.FlagsResult, sampleRate int, channels int) *analyzers.FilterChain {
+	if f.Filter == "" {
+		return nil
+	}
 
-		case "windows":
-			return malgo.BackendWasapi
+	filter, err := analyzers.ParseFilterChain(f.Filter, float64(sampleRate), channels)
+	utils.CheckErr(err)
 
-		default:
-			log.Fatalf("Unsupported operating system: %s", os)
-		}
+	return filter
+}
 
-	case "alsa":
-		return malgo.BackendAlsa
+func getAgc(f utils.FlagsResult, sampleRate int, channels int) *analyzers.AGC {
+	if !f.Agc {
+		return nil
+	}
 
-	case "pulse":
-		return malgo.BackendPulseaudio
+	return analyzers.NewAGC(f.AgcTarget, f.AgcAttack, f.AgcRelease, f.AgcMaxGain, float64(sampleRate), channels)
+}
 
-	case "jack":
-		return malgo.BackendJack
+func getDetector(f utils.FlagsResult, sampleRate int, channels int, hopSize int, effect effects.Effect) *beat.Detector {
+	beatListener, isBeatListener := effect.(effects.BeatListener)
+	tempoListener, isTempoListener := effect.(effects.TempoListener)
+	isTempoListener = isTempoListener && f.TempoSync
 
-	case "wasapi":
-		return malgo.BackendWasapi
+	if !isBeatListener && !isTempoListener && !f.PrintBeats {
+		return nil
+	}
 
-	default:
-		log.Fatalf("Unsupported backend: %s", backend)
+	detector := beat.NewDetector(
+		f.FftSize,
+		hopSize,
+		channels,
+		float64(sampleRate),
+		f.BeatLow,
+		f.BeatHigh,
+		f.BeatSensitivity,
+		f.BeatMinInterval,
+	)
+
+	if isBeatListener {
+		detector.Subscribe(beatListener.OnBeat)
+	}
+
+	if isTempoListener {
+		detector.SubscribeTempo(tempoListener.OnTempo)
 	}
 
-	return malgo.BackendNull
+	if f.PrintBeats {
+		detector.Subscribe(func(e beat.Event) {
+			tempo := detector.Tempo()
+			fmt.Printf("%.3f %.2f %.1f %.2f\n", e.Time.Seconds(), e.Strength, tempo.Bpm, tempo.Confidence)
+		})
+	}
+
+	return detector
 }
 
-func getDevice(device string) malgo.DeviceType {
-	switch device {
-	case "loopback":
-		return malgo.Loopback
+func getEffect(f utils.FlagsResult, pinger *utils.Pinger) effects.Effect {
+	switch f.Effect {
+	case "solid":
+		return effects.NewSolidColorEffect(f.LedCount, f.Color)
+
+	case "rainbow":
+		return effects.NewRainbowEffect(f.LedCount, 30)
+
+	case "luxception":
+		return effects.NewLuxceptionEffect(f.LedCount, f.Color, "0.0.0.0", utils.DefaultPort, pinger)
 
-	case "capture":
-		return malgo.Capture
+	case "pulse":
+		return effects.NewPulseEffect(f.LedCount, f.Color, pulseFadeTime)
 
 	default:
-		log.Fatalf("Unsupported device: %s", device)
+		log.Fatalf("Unsupported effect: %s", f.Effect)
+		return nil
 	}
-
-	return 0
 }
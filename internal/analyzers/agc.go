@@ -0,0 +1,77 @@
+package analyzers
+
+import (
+	"math"
+	"time"
+)
+
+// AGC adjusts the gain of the samples so that their RMS level follows a target level, so that
+// the visualization doesn't depend on the playback volume. The gain is reduced within the attack
+// time when the level rises, and increased within the release time when it falls.
+type AGC struct {
+	targetDb  float64
+	maxGainDb float64
+
+	attack  time.Duration
+	release time.Duration
+
+	samplesPerSecond float64
+
+	gainDb float64
+}
+
+func NewAGC(
+	targetDbfs float64,
+	attack time.Duration,
+	release time.Duration,
+	maxGainDb float64,
+	sampleRate float64,
+	channels int,
+) *AGC {
+	return &AGC{
+		targetDb:  targetDbfs,
+		maxGainDb: maxGainDb,
+
+		attack:  attack,
+		release: release,
+
+		samplesPerSecond: sampleRate * float64(channels),
+	}
+}
+
+// Process applies the gain to the samples in place
+func (a *AGC) Process(samples []float64) {
+	if len(samples) == 0 {
+		return
+	}
+
+	sum := 0.0
+	for _, x := range samples {
+		sum += x * x
+	}
+	levelDb := 10 * math.Log10(sum/float64(len(samples)))
+
+	targetGainDb := math.Min(a.targetDb-levelDb, a.maxGainDb)
+
+	// smoothing in dB makes the times independent of how far the level changes
+	timeConstant := a.release
+	if targetGainDb < a.gainDb {
+		timeConstant = a.attack
+	}
+
+	duration := float64(len(samples)) / a.samplesPerSecond
+	coef := 0.0
+	if timeConstant > 0 {
+		coef = math.Exp(-duration / timeConstant.Seconds())
+	}
+
+	previousGain := math.Pow(10, a.gainDb/20)
+	a.gainDb = coef*a.gainDb + (1-coef)*targetGainDb
+	gain := math.Pow(10, a.gainDb/20)
+
+	// ramp the gain across the samples to avoid steps
+	step := (gain - previousGain) / float64(len(samples))
+	for i := range samples {
+		samples[i] *= previousGain + step*float64(i+1)
+	}
+}
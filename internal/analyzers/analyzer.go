@@ -3,3 +3,13 @@ package analyzers
 type Analyzer interface {
 	Analyze([]float64) []float64
 }
+
+// newestHop returns the samples of a chunk that the previous chunk didn't have yet. The queue slides
+// its window by hopSize, so windows overlap and these are at the end.
+func newestHop(chunk []float64, hopSize int) []float64 {
+	if len(chunk) > hopSize {
+		return chunk[len(chunk)-hopSize:]
+	}
+
+	return chunk
+}
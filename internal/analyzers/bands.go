@@ -0,0 +1,148 @@
+package analyzers
+
+import (
+	"fmt"
+	"math"
+)
+
+// BandScale determines how the frequency range is divided between the LEDs
+type BandScale int
+
+const (
+	LinearBands BandScale = iota
+	LogBands
+	MelBands
+	BarkBands
+)
+
+func ParseBandScale(s string) (BandScale, error) {
+	switch s {
+	case "linear":
+		return LinearBands, nil
+	case "log":
+		return LogBands, nil
+	case "mel":
+		return MelBands, nil
+	case "bark":
+		return BarkBands, nil
+	default:
+		return LinearBands, fmt.Errorf("unsupported band scale: %s", s)
+	}
+}
+
+func (s BandScale) toScale(freq float64) float64 {
+	switch s {
+	case LogBands:
+		return math.Log2(freq)
+	case MelBands:
+		return hzToMel(freq)
+	case BarkBands:
+		// Traunmüller's approximation
+		return 26.81*freq/(1960+freq) - 0.53
+	default:
+		return freq
+	}
+}
+
+func (s BandScale) fromScale(x float64) float64 {
+	switch s {
+	case LogBands:
+		return math.Exp2(x)
+	case MelBands:
+		return melToHz(x)
+	case BarkBands:
+		return 1960 * (x + 0.53) / (26.28 - x)
+	default:
+		return x
+	}
+}
+
+func hzToMel(freq float64) float64 {
+	return 2595 * math.Log10(1+freq/700)
+}
+
+func melToHz(mel float64) float64 {
+	return 700 * (math.Pow(10, mel/2595) - 1)
+}
+
+// bandMapper averages the FFT bins of each band, where bands are equally wide on a scale
+type bandMapper struct {
+	bands []band
+
+	result []float64
+}
+
+type band struct {
+	// FFT bins in the band, empty if the band falls between two bins
+	from int
+	to   int
+
+	// fractional bin at the center of the band, to interpolate at when the band has no bins
+	center float64
+}
+
+func newBandMapper(scale BandScale, bandCount int, low float64, high float64, binWidth float64, binCount int) *bandMapper {
+	nyquist := binWidth * float64(binCount-1)
+	high = math.Min(high, nyquist)
+
+	if scale == LogBands && low < binWidth {
+		// the DC bin has no place on a log scale
+		low = binWidth
+	}
+
+	lowScaled := scale.toScale(low)
+	step := (scale.toScale(high) - lowScaled) / float64(bandCount)
+
+	bands := make([]band, bandCount)
+	for i := range bands {
+		from := scale.fromScale(lowScaled+step*float64(i)) / binWidth
+		to := scale.fromScale(lowScaled+step*float64(i+1)) / binWidth
+
+		b := band{
+			from:   int(math.Ceil(from)),
+			to:     int(math.Ceil(to)),
+			center: scale.fromScale(lowScaled+step*(float64(i)+0.5)) / binWidth,
+		}
+
+		// the last band includes the upper frequency, which doesn't survive the round trip through the scale exactly
+		if i == bandCount-1 {
+			b.to = int(math.Floor(high/binWidth)) + 1
+		}
+
+		if b.to > binCount {
+			b.to = binCount
+		}
+
+		bands[i] = b
+	}
+
+	return &bandMapper{
+		bands:  bands,
+		result: make([]float64, bandCount),
+	}
+}
+
+func (bm *bandMapper) Map(intensities []float64) []float64 {
+	for i, b := range bm.bands {
+		if b.from < b.to {
+			sum := 0.0
+			for _, x := range intensities[b.from:b.to] {
+				sum += x
+			}
+			bm.result[i] = sum / float64(b.to-b.from)
+			continue
+		}
+
+		// low bands can be narrower than a bin, so interpolate between the neighbouring bins
+		lower := int(math.Floor(b.center))
+		if lower >= len(intensities)-1 {
+			bm.result[i] = intensities[len(intensities)-1]
+			continue
+		}
+
+		frac := b.center - float64(lower)
+		bm.result[i] = intensities[lower]*(1-frac) + intensities[lower+1]*frac
+	}
+
+	return bm.result
+}
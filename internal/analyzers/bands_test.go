@@ -0,0 +1,139 @@
+package analyzers
+
+import (
+	"math"
+	"testing"
+)
+
+var bandScales = []struct {
+	name  string
+	scale BandScale
+}{
+	{"linear", LinearBands},
+	{"log", LogBands},
+	{"mel", MelBands},
+	{"bark", BarkBands},
+}
+
+func TestBandScaleRoundTrip(t *testing.T) {
+	for _, s := range bandScales {
+		for _, freq := range []float64{20, 100, 1000, 8000, 20000} {
+			if got := s.scale.fromScale(s.scale.toScale(freq)); math.Abs(got-freq) > 1e-9*freq {
+				t.Errorf("%s: %v Hz came back as %v Hz", s.name, freq, got)
+			}
+		}
+	}
+}
+
+func TestBandScaleReferencePoints(t *testing.T) {
+	tests := []struct {
+		name  string
+		scale BandScale
+		freq  float64
+		want  float64
+	}{
+		{"an octave is 1 on the log scale", LogBands, 880, math.Log2(440) + 1},
+		{"1 kHz is about 1000 mel", MelBands, 1000, 1000},
+		{"1 kHz is about 8.5 bark", BarkBands, 1000, 8.5},
+	}
+
+	for _, test := range tests {
+		if got := test.scale.toScale(test.freq); math.Abs(got-test.want) > 0.05 {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestBandMapperEdges(t *testing.T) {
+	const (
+		fftSize    = 1024
+		sampleRate = 44100
+		binCount   = fftSize/2 + 1
+		binWidth   = float64(sampleRate) / fftSize
+		low        = 20
+		high       = 20000
+	)
+
+	for _, s := range bandScales {
+		for _, bandCount := range []int{1, 10, 120} {
+			bm := newBandMapper(s.scale, bandCount, low, high, binWidth, binCount)
+
+			if len(bm.bands) != bandCount {
+				t.Fatalf("%s, %d bands: got %d bands", s.name, bandCount, len(bm.bands))
+			}
+
+			// the DC bin has no place on a log scale
+			scaleLow := float64(low)
+			if s.scale == LogBands {
+				scaleLow = binWidth
+			}
+
+			lowBin := int(math.Ceil(scaleLow / binWidth))
+			if from := bm.bands[0].from; from != lowBin {
+				t.Errorf("%s, %d bands: first band starts at bin %d, want %d", s.name, bandCount, from, lowBin)
+			}
+
+			highBin := int(math.Floor(high/binWidth)) + 1
+			if to := bm.bands[bandCount-1].to; to != highBin {
+				t.Errorf("%s, %d bands: last band ends at bin %d, want %d", s.name, bandCount, to, highBin)
+			}
+
+			for i := 1; i < bandCount; i++ {
+				if bm.bands[i].from != bm.bands[i-1].to {
+					t.Errorf("%s, %d bands: band %d starts at bin %d, but band %d ends at bin %d",
+						s.name, bandCount, i, bm.bands[i].from, i-1, bm.bands[i-1].to)
+				}
+			}
+
+			// band centers are equally spaced on the scale
+			step := (s.scale.toScale(high) - s.scale.toScale(scaleLow)) / float64(bandCount)
+			for i := 1; i < bandCount; i++ {
+				got := s.scale.toScale(bm.bands[i].center*binWidth) - s.scale.toScale(bm.bands[i-1].center*binWidth)
+				if math.Abs(got-step) > 1e-9*math.Abs(step) {
+					t.Errorf("%s, %d bands: band %d is %v wide on the scale, want %v", s.name, bandCount, i, got, step)
+				}
+			}
+		}
+	}
+}
+
+func TestBandMapperClampsToNyquist(t *testing.T) {
+	bm := newBandMapper(LogBands, 10, 20, 30000, 44100.0/1024, 513)
+
+	if to := bm.bands[9].to; to != 513 {
+		t.Errorf("last band ends at bin %d, want 513", to)
+	}
+}
+
+func TestBandMapperMap(t *testing.T) {
+	const binCount = 513
+
+	// on a ramp, the mean of a band and the interpolation at its center both equal the bin in the middle of it
+	ramp := make([]float64, binCount)
+	for i := range ramp {
+		ramp[i] = float64(i)
+	}
+
+	for _, s := range bandScales {
+		bm := newBandMapper(s.scale, 120, 20, 20000, 44100.0/1024, binCount)
+		result := bm.Map(ramp)
+
+		narrow := 0
+		for i, b := range bm.bands {
+			want := float64(b.from+b.to-1) / 2
+			if b.from >= b.to {
+				narrow++
+				want = b.center
+			}
+
+			if math.Abs(result[i]-want) > 1e-9 {
+				t.Errorf("%s: band %d (bins %d to %d, center %v) = %v, want %v", s.name, i, b.from, b.to, b.center, result[i], want)
+			}
+		}
+
+		// 120 LEDs don't fit the bass bins of a 1024-point FFT on a log scale
+		if s.scale == LogBands && narrow == 0 {
+			t.Errorf("%s: no band is narrower than a bin", s.name)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package analyzers
+
+import (
+	"fmt"
+	"github.com/ivkos/luxaudio/internal/utils"
+	"gonum.org/v1/gonum/dsp/fourier"
+	"gonum.org/v1/gonum/floats"
+	"math"
+	"math/cmplx"
+)
+
+const (
+	// kernel coefficients below this fraction of the peak of their kernel are dropped
+	cqKernelThreshold = 0.01
+
+	// the length of the low-pass filter that halves the sample rate from one octave to the next
+	cqDecimatorTaps = 31
+
+	// the shortest kernel that is repeated at lower sample rates, shorter ones sample their window too coarsely
+	cqMinSharedKernelLength = 32
+)
+
+type ConstantQAnalyzer struct {
+	ledCount int
+	hopSize  int
+
+	// from the top, the first at the full sample rate and every other one at half the rate of the one above
+	octaves     []*cqOctave
+	intensities []float64
+
+	analysis     []float64
+	coefficients []complex128
+
+	decayFactor   float64
+	dbfsThreshold float64
+
+	fft *fourier.FFT
+
+	mirror bool
+}
+
+// cqKernel is the sparse spectrum of the windowed complex sinusoid of a bin, conjugated
+type cqKernel struct {
+	from   int
+	values []complex128
+}
+
+// cqOctave holds the most recent samples of an octave, at its own sample rate
+type cqOctave struct {
+	kernels []cqKernel
+	// the index of the intensity of the first kernel
+	first int
+
+	history []float64
+
+	// halves the sample rate for the next octave, nil for the last one
+	decimator *decimator
+}
+
+// NewConstantQAnalyzer measures bins that are spaced by semitones, or finer with more binsPerOctave,
+// tuned to A4 = 440 Hz between audibleLow and audibleHigh. Every bin is analyzed with a window of
+// as many periods as needed to tell it apart from its neighbours, using the spectral kernels of
+// Brown and Puckette. The top octaves are analyzed at the full sample rate, and every octave below
+// at half the rate of the one above, so that they all share the kernels of the lowest octave at the
+// full rate and a short FFT, however long the windows of the bass notes are.
+func NewConstantQAnalyzer(
+	hopSize int,
+	ledCount int,
+	sampleRate float64,
+	decayFactor float64,
+	dbfsThreshold float64,
+	audibleLow float64,
+	audibleHigh float64,
+	binsPerOctave int,
+	mirror bool,
+	windowFunc WindowFunc,
+) (Analyzer, error) {
+	if binsPerOctave <= 0 {
+		return nil, fmt.Errorf("invalid number of bins per octave: %d", binsPerOctave)
+	}
+
+	freqs := getConstantQFreqs(binsPerOctave, audibleLow, math.Min(audibleHigh, sampleRate/2))
+	q := 1 / (math.Pow(2, 1/float64(binsPerOctave)) - 1)
+
+	// the bins at the full sample rate. The kernels of their lowest octave are repeated at lower rates,
+	// so it has to be the second one or lower, below what the decimator passes.
+	top := len(freqs) - 2*binsPerOctave
+	for top > 0 && cqKernelLength(q, freqs[top+binsPerOctave-1], sampleRate) < cqMinSharedKernelLength {
+		top -= binsPerOctave
+	}
+	if top < 0 {
+		top = 0
+	}
+
+	// the lowest of them has the longest window, the FFT is the next power of two that fits it
+	size := 1
+	for float64(size) < cqKernelLength(q, freqs[top], sampleRate) {
+		size <<= 1
+	}
+
+	fft := fourier.NewFFT(size)
+
+	kernels := make([]cqKernel, len(freqs)-top)
+	for i, f := range freqs[top:] {
+		kernels[i] = makeConstantQKernel(fft, size, q, f, sampleRate, windowFunc)
+	}
+
+	octaves := []*cqOctave{{
+		kernels: kernels,
+		first:   top,
+		history: make([]float64, size),
+	}}
+
+	for first := top - binsPerOctave; first+binsPerOctave > 0; first -= binsPerOctave {
+		above := octaves[len(octaves)-1]
+		above.decimator = newDecimator(hopSize >> uint(len(octaves)-1))
+
+		// an octave lower at half the sample rate has the same kernels
+		lower := kernels[:binsPerOctave]
+
+		octave := &cqOctave{
+			kernels: lower,
+			first:   first,
+			history: make([]float64, size),
+		}
+
+		// the lowest octave is only partly in range
+		if first < 0 {
+			octave.kernels = lower[-first:]
+			octave.first = 0
+		}
+
+		octaves = append(octaves, octave)
+	}
+
+	return &ConstantQAnalyzer{
+		ledCount: ledCount,
+		hopSize:  hopSize,
+
+		octaves:     octaves,
+		intensities: make([]float64, len(freqs)),
+
+		analysis:     make([]float64, size),
+		coefficients: make([]complex128, size/2+1),
+
+		decayFactor:   decayFactor,
+		dbfsThreshold: dbfsThreshold,
+
+		fft: fft,
+
+		mirror: mirror,
+	}, nil
+}
+
+func (ca *ConstantQAnalyzer) Analyze(sampleChunk []float64) []float64 {
+	samples := newestHop(sampleChunk, ca.hopSize)
+
+	for _, octave := range ca.octaves {
+		pushHistory(octave.history, samples)
+
+		// the kernels are windowed already
+		copy(ca.analysis, octave.history)
+		ffs := ca.fft.Coefficients(ca.coefficients, ca.analysis)
+
+		for i, kernel := range octave.kernels {
+			var sum complex128
+			for j, k := range kernel.values {
+				sum += ffs[kernel.from+j] * k
+			}
+
+			// a full scale sine has a magnitude of 0.5
+			db := 20 * math.Log10(2*cmplx.Abs(sum))
+
+			n := octave.first + i
+			ca.intensities[n] = decayIntensity(ca.intensities[n], dbToIntensity(db, ca.dbfsThreshold), ca.decayFactor)
+		}
+
+		if octave.decimator != nil {
+			samples = octave.decimator.Process(samples)
+		}
+	}
+
+	result := ca.intensities
+	if ca.mirror {
+		result = mirrorResult(result)
+	}
+
+	result = utils.ChunkedMean(result, ca.ledCount)
+	result = utils.StretchArray(result, ca.ledCount)
+
+	return result
+}
+
+// pushHistory appends samples to the end of history, dropping the oldest ones
+func pushHistory(history []float64, samples []float64) {
+	if len(samples) >= len(history) {
+		copy(history, samples[len(samples)-len(history):])
+		return
+	}
+
+	copy(history, history[len(samples):])
+	copy(history[len(history)-len(samples):], samples)
+}
+
+// decimator halves the sample rate of a stream. It low-pass filters it first, keeping what's below a quarter
+// of the original rate, which is all that the octave below needs.
+type decimator struct {
+	taps []float64
+
+	// the most recent samples, twice, so that they can be read in one piece from any position
+	delay []float64
+	pos   int
+	skip  bool
+
+	output []float64
+}
+
+func newDecimator(maxInput int) *decimator {
+	// a windowed sinc, cut off halfway between the passband and where aliases would fold into it
+	taps := cosineWindow(0.42, 0.5, 0.08)(cqDecimatorTaps)
+	center := float64(cqDecimatorTaps-1) / 2
+	for n := range taps {
+		x := (float64(n) - center) / 2
+		if x != 0 {
+			taps[n] *= math.Sin(math.Pi*x) / (math.Pi * x)
+		}
+	}
+	floats.Scale(1/floats.Sum(taps), taps)
+
+	return &decimator{
+		taps:   taps,
+		delay:  make([]float64, 2*cqDecimatorTaps),
+		output: make([]float64, 0, maxInput/2+1),
+	}
+}
+
+// Process returns every other sample of the filtered input. The returned slice is reused by the next call.
+func (d *decimator) Process(input []float64) []float64 {
+	n := len(d.taps)
+	d.output = d.output[:0]
+
+	for _, x := range input {
+		d.delay[d.pos] = x
+		d.delay[d.pos+n] = x
+		d.pos = (d.pos + 1) % n
+
+		d.skip = !d.skip
+		if d.skip {
+			continue
+		}
+
+		d.output = append(d.output, floats.Dot(d.taps, d.delay[d.pos:d.pos+n]))
+	}
+
+	return d.output
+}
+
+func getConstantQFreqs(binsPerOctave int, low float64, high float64) []float64 {
+	// the lowest bin on the grid of A4 = 440 Hz that isn't below low
+	first := math.Ceil(float64(binsPerOctave) * math.Log2(math.Max(low, 1)/440))
+
+	freqs := make([]float64, 0)
+	for n := first; ; n++ {
+		f := 440 * math.Pow(2, n/float64(binsPerOctave))
+		if f > high {
+			break
+		}
+
+		freqs = append(freqs, f)
+	}
+
+	if len(freqs) == 0 {
+		freqs = append(freqs, low)
+	}
+
+	return freqs
+}
+
+func makeConstantQKernel(
+	fft *fourier.FFT,
+	fftSize int,
+	q float64,
+	freq float64,
+	sampleRate float64,
+	windowFunc WindowFunc,
+) cqKernel {
+	length := int(math.Ceil(cqKernelLength(q, freq, sampleRate)))
+	if length > fftSize {
+		length = fftSize
+	}
+
+	window := windowFunc(length)
+	windowSum := 0.0
+	for _, w := range window {
+		windowSum += w
+	}
+
+	// align the kernels to the end of the chunk, so that short ones see the most recent samples
+	offset := fftSize - length
+
+	// the real and imaginary parts are transformed separately, since the samples are real
+	re := make([]float64, fftSize)
+	im := make([]float64, fftSize)
+	for n, w := range window {
+		phase := 2 * math.Pi * freq * float64(n) / sampleRate
+		re[offset+n] = w / windowSum * math.Cos(phase)
+		im[offset+n] = w / windowSum * math.Sin(phase)
+	}
+
+	reSpectrum := fft.Coefficients(nil, re)
+	imSpectrum := fft.Coefficients(nil, im)
+
+	// for positive frequencies, the spectrum of the complex sinusoid is reSpectrum + i * imSpectrum
+	spectrum := make([]complex128, len(reSpectrum))
+	peak := 0.0
+	for j := range spectrum {
+		spectrum[j] = reSpectrum[j] + complex(0, 1)*imSpectrum[j]
+		peak = math.Max(peak, cmplx.Abs(spectrum[j]))
+	}
+
+	from, to := 0, len(spectrum)-1
+	for from < to && cmplx.Abs(spectrum[from]) < cqKernelThreshold*peak {
+		from++
+	}
+	for to > from && cmplx.Abs(spectrum[to]) < cqKernelThreshold*peak {
+		to--
+	}
+
+	// by Parseval's theorem, the correlation with the sinusoid is the product with the conjugated spectrum, over fftSize
+	values := make([]complex128, to-from+1)
+	for j := range values {
+		values[j] = cmplx.Conj(spectrum[from+j]) / complex(float64(fftSize), 0)
+	}
+
+	return cqKernel{
+		from:   from,
+		values: values,
+	}
+}
+
+// cqKernelLength is the number of samples of the window of a bin, q periods of its frequency
+func cqKernelLength(q float64, freq float64, sampleRate float64) float64 {
+	return q * sampleRate / freq
+}
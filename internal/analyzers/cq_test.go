@@ -0,0 +1,145 @@
+package analyzers
+
+import (
+	"github.com/ivkos/luxaudio/internal/utils"
+	"math"
+	"testing"
+)
+
+const (
+	cqSampleRate = 44100
+	cqHopSize    = cqSampleRate / 60
+)
+
+func newTestConstantQAnalyzer(t testing.TB, binsPerOctave int, low float64, high float64) (*ConstantQAnalyzer, []float64) {
+	freqs := getConstantQFreqs(binsPerOctave, low, high)
+
+	// one LED per bin, so that every bin can be read off
+	analyzer, err := NewConstantQAnalyzer(cqHopSize, len(freqs), cqSampleRate, 0, -96, low, high, binsPerOctave, false, utils.GetHannWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return analyzer.(*ConstantQAnalyzer), freqs
+}
+
+// analyzeSine feeds the analyzer a sine, a hop at a time like the queue does, for long enough to fill the longest window
+func analyzeSine(ca *ConstantQAnalyzer, freq float64, amplitude float64) []float64 {
+	const fftSize = 1024
+
+	samples := sine(2*cqSampleRate, freq, cqSampleRate, amplitude)
+
+	var result []float64
+	for end := fftSize; end <= len(samples); end += cqHopSize {
+		result = ca.Analyze(append([]float64(nil), samples[end-fftSize:end]...))
+	}
+
+	return result
+}
+
+func TestConstantQAnalyzerResolvesEveryOctave(t *testing.T) {
+	tests := []struct {
+		binsPerOctave int
+		low           float64
+		high          float64
+	}{
+		{12, 20, 20000},
+		{24, 27.5, 4000},
+		{3, 20, 20000},
+		// shorter than the octaves at the full sample rate
+		{12, 20, 30},
+	}
+
+	for _, test := range tests {
+		ca, freqs := newTestConstantQAnalyzer(t, test.binsPerOctave, test.low, test.high)
+
+		for i := 0; i < len(freqs); i += 5 {
+			result := analyzeSine(ca, freqs[i], 0.5)
+
+			peak := 0
+			for j := range result {
+				if result[j] > result[peak] {
+					peak = j
+				}
+			}
+
+			if peak != i {
+				t.Errorf("%d bins per octave: a %.1f Hz sine peaks at the %.1f Hz bin", test.binsPerOctave, freqs[i], freqs[peak])
+			}
+
+			// -6 dBFS on a scale from -96 to 0 dBFS
+			want := (96 + 20*math.Log10(0.5)) / 96
+			if math.Abs(result[i]-want) > 0.5/96 {
+				t.Errorf("%d bins per octave: a -6 dBFS sine at %.1f Hz reads %.2f dBFS", test.binsPerOctave, freqs[i], result[i]*96-96)
+			}
+
+			if test.binsPerOctave < 12 {
+				continue
+			}
+
+			// semitones are told apart
+			for _, j := range []int{i - test.binsPerOctave/6, i + test.binsPerOctave/6} {
+				if j >= 0 && j < len(result) && result[j] > result[i]-12.0/96 {
+					t.Errorf("%d bins per octave: a %.1f Hz sine reads %.2f dBFS at the %.1f Hz bin",
+						test.binsPerOctave, freqs[i], result[j]*96-96, freqs[j])
+				}
+			}
+		}
+	}
+}
+
+func TestDecimator(t *testing.T) {
+	tests := []struct {
+		// as a fraction of the input sample rate
+		freq float64
+		// the level of the output, with a tolerance, in dB
+		want      float64
+		tolerance float64
+	}{
+		{0, 0, 0.01},
+		// the octave below needs everything up to half of its Nyquist frequency
+		{1.0 / 16, 0, 0.01},
+		{1.0 / 8, 0, 0.05},
+		// which aliases fold into
+		{3.0 / 8, -80, 20},
+		{7.0 / 16, -80, 20},
+	}
+
+	for _, test := range tests {
+		d := newDecimator(1000)
+
+		var output []float64
+		for i := 0; i < 4; i++ {
+			input := make([]float64, 1000)
+			for n := range input {
+				input[n] = math.Cos(2 * math.Pi * test.freq * float64(i*len(input)+n))
+			}
+			output = append(output[:0], d.Process(input)...)
+		}
+
+		if len(output) != 500 {
+			t.Fatalf("got %d samples, want 500", len(output))
+		}
+
+		peak := 0.0
+		for _, x := range output {
+			peak = math.Max(peak, math.Abs(x))
+		}
+
+		if db := 20 * math.Log10(peak); math.Abs(db-test.want) > test.tolerance {
+			t.Errorf("a sine at %v of the sample rate comes out at %.2f dB, want %.0f dB", test.freq, db, test.want)
+		}
+	}
+}
+
+func BenchmarkConstantQAnalyzer(b *testing.B) {
+	ca, _ := newTestConstantQAnalyzer(b, 12, 20, 20000)
+	chunk := sine(1024, 440, cqSampleRate, 0.5)
+	analysis := make([]float64, len(chunk))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		copy(analysis, chunk)
+		ca.Analyze(analysis)
+	}
+}
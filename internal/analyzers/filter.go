@@ -0,0 +1,206 @@
+package analyzers
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// biquad holds the normalized coefficients of a second order IIR filter
+type biquad struct {
+	b0, b1, b2 float64
+	a1, a2     float64
+}
+
+// biquadState is the state of a biquad in transposed direct form II
+type biquadState struct {
+	z1, z2 float64
+}
+
+// FilterChain runs the interleaved samples through a series of biquad filters,
+// keeping separate state for every channel
+type FilterChain struct {
+	filters  []biquad
+	channels int
+
+	// indexed by filter, then by channel
+	states [][]biquadState
+}
+
+// ParseFilterChain creates a filter chain from a comma-separated list of filters, each given as type:parameters:
+//
+//	hp:freq[:q]              high-pass
+//	lp:freq[:q]              low-pass
+//	lowshelf:freq:gain[:q]   low shelf, gain in dB
+//	highshelf:freq:gain[:q]  high shelf, gain in dB
+//	peak:freq:gain[:q]       peaking EQ, gain in dB
+//	preemphasis[:coef]       first order pre-emphasis y[n] = x[n] - coef * x[n-1]
+//
+// e.g. "hp:30,lp:16000,peak:3000:-4:1.5"
+func ParseFilterChain(spec string, sampleRate float64, channels int) (*FilterChain, error) {
+	fc := &FilterChain{
+		filters:  make([]biquad, 0),
+		channels: channels,
+		states:   make([][]biquadState, 0),
+	}
+
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+
+		f, err := parseFilter(s, sampleRate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter %q: %v", s, err)
+		}
+
+		fc.filters = append(fc.filters, f)
+		fc.states = append(fc.states, make([]biquadState, channels))
+	}
+
+	return fc, nil
+}
+
+// Process filters the samples in place
+func (fc *FilterChain) Process(samples []float64) {
+	for i, f := range fc.filters {
+		states := fc.states[i]
+
+		for j, x := range samples {
+			st := &states[j%fc.channels]
+
+			y := f.b0*x + st.z1
+			st.z1 = f.b1*x - f.a1*y + st.z2
+			st.z2 = f.b2*x - f.a2*y
+
+			samples[j] = y
+		}
+	}
+}
+
+func parseFilter(s string, sampleRate float64) (biquad, error) {
+	parts := strings.Split(s, ":")
+	kind := strings.ToLower(parts[0])
+
+	params := make([]float64, len(parts)-1)
+	for i, p := range parts[1:] {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return biquad{}, fmt.Errorf("invalid parameter %q", p)
+		}
+		params[i] = v
+	}
+
+	// returns the i-th parameter, or def if it was omitted
+	param := func(i int, def float64) float64 {
+		if i < len(params) {
+			return params[i]
+		}
+		return def
+	}
+
+	if kind == "preemphasis" {
+		if len(params) > 1 {
+			return biquad{}, fmt.Errorf("expected at most 1 parameter, got %d", len(params))
+		}
+
+		return biquad{b0: 1, b1: -param(0, 0.97)}, nil
+	}
+
+	minParams, maxParams := 1, 2
+	switch kind {
+	case "hp", "lp":
+	case "lowshelf", "highshelf", "peak":
+		minParams, maxParams = 2, 3
+	default:
+		return biquad{}, fmt.Errorf("unknown type %q", kind)
+	}
+
+	if len(params) < minParams || len(params) > maxParams {
+		return biquad{}, fmt.Errorf("expected %d to %d parameters, got %d", minParams, maxParams, len(params))
+	}
+
+	freq := params[0]
+	if freq <= 0 || freq >= sampleRate/2 {
+		return biquad{}, fmt.Errorf("frequency must be between 0 and %.0f Hz", sampleRate/2)
+	}
+
+	gain := 0.0
+	q := math.Sqrt2 / 2
+	if maxParams == 2 {
+		q = param(1, q)
+	} else {
+		gain = params[1]
+		q = param(2, q)
+	}
+
+	if q <= 0 {
+		return biquad{}, fmt.Errorf("q must be positive")
+	}
+
+	return makeBiquad(kind, freq, gain, q, sampleRate), nil
+}
+
+// makeBiquad calculates the coefficients with the formulas of the Audio EQ Cookbook by Robert Bristow-Johnson
+func makeBiquad(kind string, freq float64, gainDb float64, q float64, sampleRate float64) biquad {
+	w0 := 2 * math.Pi * freq / sampleRate
+	cosW0 := math.Cos(w0)
+	alpha := math.Sin(w0) / (2 * q)
+	A := math.Pow(10, gainDb/40)
+
+	var b0, b1, b2, a0, a1, a2 float64
+
+	switch kind {
+	case "hp":
+		b0 = (1 + cosW0) / 2
+		b1 = -(1 + cosW0)
+		b2 = (1 + cosW0) / 2
+		a0 = 1 + alpha
+		a1 = -2 * cosW0
+		a2 = 1 - alpha
+
+	case "lp":
+		b0 = (1 - cosW0) / 2
+		b1 = 1 - cosW0
+		b2 = (1 - cosW0) / 2
+		a0 = 1 + alpha
+		a1 = -2 * cosW0
+		a2 = 1 - alpha
+
+	case "peak":
+		b0 = 1 + alpha*A
+		b1 = -2 * cosW0
+		b2 = 1 - alpha*A
+		a0 = 1 + alpha/A
+		a1 = -2 * cosW0
+		a2 = 1 - alpha/A
+
+	case "lowshelf":
+		beta := 2 * math.Sqrt(A) * alpha
+		b0 = A * ((A + 1) - (A-1)*cosW0 + beta)
+		b1 = 2 * A * ((A - 1) - (A+1)*cosW0)
+		b2 = A * ((A + 1) - (A-1)*cosW0 - beta)
+		a0 = (A + 1) + (A-1)*cosW0 + beta
+		a1 = -2 * ((A - 1) + (A+1)*cosW0)
+		a2 = (A + 1) + (A-1)*cosW0 - beta
+
+	case "highshelf":
+		beta := 2 * math.Sqrt(A) * alpha
+		b0 = A * ((A + 1) + (A-1)*cosW0 + beta)
+		b1 = -2 * A * ((A - 1) + (A+1)*cosW0)
+		b2 = A * ((A + 1) + (A-1)*cosW0 - beta)
+		a0 = (A + 1) - (A-1)*cosW0 + beta
+		a1 = 2 * ((A - 1) - (A+1)*cosW0)
+		a2 = (A + 1) - (A-1)*cosW0 - beta
+	}
+
+	return biquad{
+		b0: b0 / a0,
+		b1: b1 / a0,
+		b2: b2 / a0,
+		a1: a1 / a0,
+		a2: a2 / a0,
+	}
+}
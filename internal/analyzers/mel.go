@@ -0,0 +1,156 @@
+package analyzers
+
+import (
+	"github.com/ivkos/luxaudio/internal/utils"
+	"gonum.org/v1/gonum/dsp/fourier"
+	"gonum.org/v1/gonum/floats"
+	"math"
+	"math/cmplx"
+)
+
+type MelAnalyzer struct {
+	ledCount int
+
+	filters     []melFilter
+	intensities []float64
+	power       []float64
+
+	decayFactor   float64
+	dbfsThreshold float64
+
+	window    []float64
+	reference float64
+	fft       *fourier.FFT
+
+	mirror bool
+}
+
+// melFilter is a triangular filter, weighting the FFT bins starting at from
+type melFilter struct {
+	from    int
+	weights []float64
+}
+
+// NewMelAnalyzer measures the energy in filterCount triangular filters, which are equally spaced
+// and overlap by half on the Mel scale between audibleLow and audibleHigh.
+// If filterCount is 0, there is one filter per LED.
+func NewMelAnalyzer(
+	fftSize int,
+	ledCount int,
+	sampleRate float64,
+	decayFactor float64,
+	dbfsThreshold float64,
+	audibleLow float64,
+	audibleHigh float64,
+	filterCount int,
+	mirror bool,
+	windowFunc WindowFunc,
+) Analyzer {
+	if filterCount <= 0 {
+		filterCount = ledCount
+		if mirror {
+			filterCount = ledCount / 2
+		}
+	}
+	if filterCount < 1 {
+		filterCount = 1
+	}
+
+	binCount := fftSize/2 + 1
+	filters := makeMelFilters(filterCount, audibleLow, audibleHigh, sampleRate/float64(fftSize), binCount)
+
+	window := windowFunc(fftSize)
+
+	return &MelAnalyzer{
+		ledCount: ledCount,
+
+		filters:     filters,
+		intensities: make([]float64, filterCount),
+		power:       make([]float64, binCount),
+
+		decayFactor:   decayFactor,
+		dbfsThreshold: dbfsThreshold,
+
+		window:    window,
+		reference: windowReference(window),
+		fft:       fourier.NewFFT(fftSize),
+
+		mirror: mirror,
+	}
+}
+
+func (ma *MelAnalyzer) Analyze(sampleChunk []float64) []float64 {
+	floats.Mul(sampleChunk, ma.window)
+	ffs := ma.fft.Coefficients(nil, sampleChunk)
+
+	for i := range ma.power {
+		magnitude := cmplx.Abs(ffs[i]) / ma.reference
+		ma.power[i] = magnitude * magnitude
+	}
+
+	for i, filter := range ma.filters {
+		energy := floats.Dot(filter.weights, ma.power[filter.from:filter.from+len(filter.weights)])
+
+		db := 10 * math.Log10(energy)
+		ma.intensities[i] = decayIntensity(ma.intensities[i], dbToIntensity(db, ma.dbfsThreshold), ma.decayFactor)
+	}
+
+	result := ma.intensities
+	if ma.mirror {
+		result = mirrorResult(result)
+	}
+
+	result = utils.ChunkedMean(result, ma.ledCount)
+	result = utils.StretchArray(result, ma.ledCount)
+
+	return result
+}
+
+func makeMelFilters(filterCount int, low float64, high float64, binWidth float64, binCount int) []melFilter {
+	high = math.Min(high, binWidth*float64(binCount-1))
+
+	lowMel := hzToMel(low)
+	step := (hzToMel(high) - lowMel) / float64(filterCount+1)
+
+	filters := make([]melFilter, filterCount)
+	for i := range filters {
+		// in fractional bins
+		left := melToHz(lowMel+step*float64(i)) / binWidth
+		center := melToHz(lowMel+step*float64(i+1)) / binWidth
+		right := melToHz(lowMel+step*float64(i+2)) / binWidth
+
+		from := int(math.Ceil(left))
+		to := int(math.Min(math.Floor(right), float64(binCount-1)))
+
+		weights := make([]float64, 0)
+		for bin := from; bin <= to; bin++ {
+			x := float64(bin)
+
+			w := 0.0
+			if x <= center && center > left {
+				w = (x - left) / (center - left)
+			} else if x > center && right > center {
+				w = (right - x) / (right - center)
+			}
+
+			weights = append(weights, math.Max(w, 0))
+		}
+
+		// low filters can be narrower than a bin, so interpolate between the neighbouring bins instead
+		if floats.Sum(weights) == 0 {
+			from = int(math.Min(math.Floor(center), float64(binCount-2)))
+			frac := math.Min(center-float64(from), 1)
+			weights = []float64{1 - frac, frac}
+		}
+
+		// normalize, so that the level doesn't depend on the width of the filter
+		floats.Scale(1/floats.Sum(weights), weights)
+
+		filters[i] = melFilter{
+			from:    from,
+			weights: weights,
+		}
+	}
+
+	return filters
+}
@@ -0,0 +1,107 @@
+package analyzers
+
+import (
+	"github.com/ivkos/luxaudio/internal/utils"
+	"gonum.org/v1/gonum/floats"
+	"math"
+	"testing"
+)
+
+func TestMelFilters(t *testing.T) {
+	tests := []struct {
+		name        string
+		filterCount int
+		fftSize     int
+		low         float64
+		high        float64
+	}{
+		{"few wide filters", 10, 1024, 20, 20000},
+		{"one per LED", 120, 1024, 20, 20000},
+		{"narrower than a bin", 120, 256, 20, 20000},
+		{"above nyquist", 40, 1024, 100, 40000},
+		{"single filter", 1, 1024, 20, 20000},
+	}
+
+	const sampleRate = 44100
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			binWidth := sampleRate / float64(test.fftSize)
+			binCount := test.fftSize/2 + 1
+			filters := makeMelFilters(test.filterCount, test.low, test.high, binWidth, binCount)
+
+			if len(filters) != test.filterCount {
+				t.Fatalf("got %d filters, want %d", len(filters), test.filterCount)
+			}
+
+			high := math.Min(test.high, binWidth*float64(binCount-1))
+			step := (hzToMel(high) - hzToMel(test.low)) / float64(test.filterCount+1)
+
+			previousPeak := -1
+			for i, f := range filters {
+				if f.from < 0 || f.from+len(f.weights) > binCount {
+					t.Fatalf("filter %d spans bins %d to %d, outside of the %d bins", i, f.from, f.from+len(f.weights), binCount)
+				}
+
+				// normalized, so that the level doesn't depend on the width of the filter
+				if sum := floats.Sum(f.weights); math.Abs(sum-1) > 1e-9 {
+					t.Errorf("filter %d weights sum to %v, want 1", i, sum)
+				}
+				if min := floats.Min(f.weights); min < 0 {
+					t.Errorf("filter %d has a negative weight %v", i, min)
+				}
+
+				// triangular: rises up to the bin closest to the center and falls after it
+				peak := floats.MaxIdx(f.weights)
+				for j := 1; j < len(f.weights); j++ {
+					if j <= peak && f.weights[j] < f.weights[j-1] || j > peak && f.weights[j] > f.weights[j-1] {
+						t.Errorf("filter %d isn't triangular: %v", i, f.weights)
+						break
+					}
+				}
+
+				center := melToHz(hzToMel(test.low)+step*float64(i+1)) / binWidth
+				if peakBin := float64(f.from + peak); math.Abs(peakBin-center) > 1 {
+					t.Errorf("filter %d peaks at bin %v, want %v", i, peakBin, center)
+				}
+
+				if f.from+peak < previousPeak {
+					t.Errorf("filter %d peaks at bin %d, below the previous filter", i, f.from+peak)
+				}
+				previousPeak = f.from + peak
+			}
+		})
+	}
+}
+
+func TestMelAnalyzerPeaksAtTheFilterOfASine(t *testing.T) {
+	const (
+		fftSize     = 4096
+		sampleRate  = 44100
+		filterCount = 24
+		low         = 50
+		high        = 16000
+	)
+
+	step := (hzToMel(high) - hzToMel(low)) / (filterCount + 1)
+
+	for _, filter := range []int{4, 12, 20} {
+		freq := melToHz(hzToMel(low) + step*float64(filter+1))
+
+		analyzer := NewMelAnalyzer(fftSize, filterCount, sampleRate, 0, -96, low, high, filterCount, false, utils.GetHannWindow)
+		result := analyzer.Analyze(sine(fftSize, freq, sampleRate, 1))
+
+		if got := floats.MaxIdx(result); got != filter {
+			t.Errorf("a %.0f Hz sine peaks at filter %d, want %d", freq, got, filter)
+		}
+	}
+}
+
+func sine(size int, freq float64, sampleRate float64, amplitude float64) []float64 {
+	samples := make([]float64, size)
+	for n := range samples {
+		samples[n] = amplitude * math.Sin(2*math.Pi*freq*float64(n)/sampleRate)
+	}
+
+	return samples
+}
@@ -0,0 +1,179 @@
+package analyzers
+
+import (
+	"fmt"
+	"github.com/ivkos/luxaudio/internal/utils"
+	"math"
+)
+
+const (
+	// a VU meter rises to 99% of a step within 300 ms, which a critically damped
+	// pair of one-pole filters does with this time constant
+	vuTimeConstant = 0.045
+
+	// a DIN PPM reads a 10 ms burst 1 dB low and falls back by 20 dB in 1.7 s
+	ppmAttackTimeConstant = 0.0015
+	ppmFallback           = 20 / 1.7
+
+	// the RMS is averaged with the time constant of a sound level meter set to fast
+	rmsTimeConstant = 0.125
+
+	// how long the peak dot stays before falling back like a PPM
+	peakHoldTime = 1.0
+)
+
+// MeterAnalyzer renders the level of the input as a bar, like a VU meter, a PPM or an RMS meter, with a dot
+// showing the recent sample peak. The bar spans the LEDs from floorDb to 0 dBFS. A full scale sine reads 0 dBFS.
+type MeterAnalyzer struct {
+	barLength  int
+	ledCount   int
+	hopSize    int
+	sampleRate float64
+	mode       string
+	floorDb    float64
+	mirror     bool
+
+	// linear, as the amplitude of a sine with the same reading
+	level float64
+	// the first stage of the VU filter, or the mean square for RMS
+	average float64
+
+	peak     float64
+	peakHold int
+
+	bar []float64
+}
+
+func NewMeterAnalyzer(
+	ledCount int,
+	hopSize int,
+	sampleRate float64,
+	mode string,
+	floorDb float64,
+	mirror bool,
+) (Analyzer, error) {
+	if mode != "vu" && mode != "ppm" && mode != "rms" {
+		return nil, fmt.Errorf("unsupported meter: %s", mode)
+	}
+
+	// a single LED can't be mirrored
+	mirror = mirror && ledCount >= 2
+
+	barLength := ledCount
+	if mirror {
+		barLength = ledCount / 2
+	}
+
+	return &MeterAnalyzer{
+		barLength:  barLength,
+		ledCount:   ledCount,
+		hopSize:    hopSize,
+		sampleRate: sampleRate,
+		mode:       mode,
+		floorDb:    floorDb,
+		mirror:     mirror,
+
+		bar: make([]float64, barLength),
+	}, nil
+}
+
+func (ma *MeterAnalyzer) Analyze(sampleChunk []float64) []float64 {
+	samples := newestHop(sampleChunk, ma.hopSize)
+
+	vuCoef := 1 - math.Exp(-1/(vuTimeConstant*ma.sampleRate))
+	rmsCoef := 1 - math.Exp(-1/(rmsTimeConstant*ma.sampleRate))
+	attackCoef := 1 - math.Exp(-1/(ppmAttackTimeConstant*ma.sampleRate))
+	fallback := math.Pow(10, -ppmFallback/20/ma.sampleRate)
+	holdSamples := int(peakHoldTime * ma.sampleRate)
+
+	for _, x := range samples {
+		x = math.Abs(x)
+
+		switch ma.mode {
+		case "ppm":
+			if x > ma.level {
+				ma.level += (x - ma.level) * attackCoef
+			} else {
+				ma.level *= fallback
+			}
+
+		case "rms":
+			// the RMS of a sine is 1/sqrt(2) of its amplitude
+			ma.average += (x*x - ma.average) * rmsCoef
+			ma.level = math.Sqrt(2 * ma.average)
+
+		default:
+			// the average of a rectified sine is 2/pi of its amplitude
+			ma.average += (x*math.Pi/2 - ma.average) * vuCoef
+			ma.level += (ma.average - ma.level) * vuCoef
+		}
+
+		if x >= ma.peak {
+			ma.peak = x
+			ma.peakHold = holdSamples
+		} else if ma.peakHold > 0 {
+			ma.peakHold--
+		} else {
+			ma.peak *= fallback
+		}
+	}
+
+	for i := range ma.bar {
+		ma.bar[i] = 0
+	}
+
+	lit := ma.position(ma.level)
+	for i := 0; i < ma.barLength && float64(i) < lit; i++ {
+		ma.bar[i] = math.Min(lit-float64(i), 1)
+	}
+
+	if peak := ma.position(ma.peak); peak > 0 {
+		ma.bar[int(math.Min(peak, float64(ma.barLength-1)))] = 1
+	}
+
+	result := ma.bar
+	if ma.mirror {
+		result = mirrorResult(result)
+	}
+
+	return utils.CenterArray(result, ma.ledCount)
+}
+
+// position is how many LEDs of the bar are lit at a level
+func (ma *MeterAnalyzer) position(level float64) float64 {
+	db := 20 * math.Log10(level)
+	return dbToIntensity(db, ma.floorDb) * float64(ma.barLength)
+}
+
+// MeterRedZone tells which LEDs of a meter with the same layout show levels above redZoneDb.
+// In stereo, the channels are shown like in mirror mode.
+func MeterRedZone(ledCount int, floorDb float64, redZoneDb float64, mirror bool, stereo bool) []bool {
+	bar := func(length int) []float64 {
+		r := make([]float64, length)
+		for i := range r {
+			// the level at which the LED starts to light up
+			r[i] = floorDb * (1 - float64(i)/float64(length))
+		}
+		return r
+	}
+
+	var levels []float64
+	switch {
+	case stereo:
+		levels = joinMirrored(bar(ledCount/2), bar(ledCount-ledCount/2))
+	case mirror && ledCount >= 2:
+		half := bar(ledCount / 2)
+		levels = joinMirrored(half, half)
+	default:
+		levels = bar(ledCount)
+	}
+
+	zone := make([]bool, ledCount)
+	offset := (ledCount - len(levels)) / 2
+
+	for i, level := range levels {
+		zone[offset+i] = level >= redZoneDb
+	}
+
+	return zone
+}
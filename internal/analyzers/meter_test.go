@@ -0,0 +1,130 @@
+package analyzers
+
+import (
+	"math"
+	"testing"
+)
+
+const (
+	meterSampleRate = 48000
+	// a millisecond, so that levels can be read at any time in ms
+	meterHopSize = meterSampleRate / 1000
+)
+
+func newTestMeter(t *testing.T, mode string) *MeterAnalyzer {
+	analyzer, err := NewMeterAnalyzer(60, meterHopSize, meterSampleRate, mode, -60, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return analyzer.(*MeterAnalyzer)
+}
+
+// feed runs the meter over the samples and returns its level in dB after every millisecond
+func feed(ma *MeterAnalyzer, samples []float64) []float64 {
+	levels := make([]float64, 0, len(samples)/meterHopSize)
+	for i := 0; i+meterHopSize <= len(samples); i += meterHopSize {
+		ma.Analyze(append([]float64(nil), samples[i:i+meterHopSize]...))
+		levels = append(levels, 20*math.Log10(ma.level))
+	}
+
+	return levels
+}
+
+func meterSine(ms int, amplitude float64) []float64 {
+	return sine(ms*meterHopSize, 1000, meterSampleRate, amplitude)
+}
+
+func TestMeterReadsSineLevel(t *testing.T) {
+	for _, mode := range []string{"vu", "ppm", "rms"} {
+		for _, db := range []float64{0, -20, -40} {
+			ma := newTestMeter(t, mode)
+			levels := feed(ma, meterSine(3000, math.Pow(10, db/20)))
+
+			if got := levels[len(levels)-1]; math.Abs(got-db) > 0.2 {
+				t.Errorf("%s: a %v dBFS sine reads %.2f dBFS", mode, db, got)
+			}
+		}
+	}
+}
+
+func TestMeterBallistics(t *testing.T) {
+	tests := []struct {
+		name string
+		mode string
+		// how long the sine plays before it stops, in ms
+		tone int
+		// the level in dB after this many ms from the start, with a tolerance
+		at        int
+		want      float64
+		tolerance float64
+		// if set, the level is relative to the one when the sine stops
+		relative bool
+	}{
+		// IEC 60268-17: a VU meter reaches 99% of a step within 300 ms
+		{"vu rises to 99% in 300 ms", "vu", 3000, 300, 20 * math.Log10(0.99), 0.05, false},
+		{"vu is still rising at 150 ms", "vu", 3000, 150, 20 * math.Log10(0.845), 0.1, false},
+		{"vu falls to 1% in 300 ms", "vu", 3000, 3300, -40, 1, false},
+
+		// DIN 45406: a 10 ms burst reads -1 dB, and the level falls back by 20 dB in 1.7 s
+		{"ppm reads a 10 ms burst", "ppm", 10, 10, -1, 0.2, false},
+		{"ppm reads a 5 ms burst", "ppm", 5, 5, -2, 0.5, false},
+		{"ppm falls back by 20 dB in 1.7 s", "ppm", 3000, 4700, -20, 0.05, true},
+
+		// fast time weighting: the mean square reaches 1-1/e of a step in 125 ms
+		{"rms rises with a 125 ms time constant", "rms", 3000, 125, 10 * math.Log10(1-1/math.E), 0.1, false},
+		{"rms falls with a 125 ms time constant", "rms", 3000, 3125, 10 * math.Log10(1/math.E), 0.1, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ma := newTestMeter(t, test.mode)
+			levels := feed(ma, append(meterSine(test.tone, 1), make([]float64, 5000*meterHopSize)...))
+
+			got := levels[test.at-1]
+			if test.relative {
+				got -= levels[test.tone-1]
+			}
+
+			if math.Abs(got-test.want) > test.tolerance {
+				t.Errorf("%s meter reads %.2f dB after %d ms, want %.2f dB", test.mode, got, test.at, test.want)
+			}
+		})
+	}
+}
+
+func TestMeterRmsIsBelowPeakOnASine(t *testing.T) {
+	ma := newTestMeter(t, "rms")
+	feed(ma, meterSine(3000, 1))
+
+	// the reading is scaled to the sine's amplitude, the actual RMS is 3 dB lower
+	rms := 10 * math.Log10(ma.average)
+	peak := 20 * math.Log10(ma.peak)
+
+	if math.Abs(peak) > 0.01 {
+		t.Errorf("peak of a full scale sine is %.2f dBFS, want 0 dBFS", peak)
+	}
+	if diff := peak - rms; math.Abs(diff-10*math.Log10(2)) > 0.05 {
+		t.Errorf("rms is %.2f dB below the peak, want 3.01 dB", diff)
+	}
+}
+
+func TestMeterBarLength(t *testing.T) {
+	// the bar spans the 60 LEDs from -60 to 0 dBFS, so a -30 dBFS sine lights half of them
+	ma := newTestMeter(t, "rms")
+	feed(ma, meterSine(3000, math.Pow(10, -30.0/20)))
+
+	bar := ma.Analyze(meterSine(1, math.Pow(10, -30.0/20)))
+	if len(bar) != 60 {
+		t.Fatalf("got %d LEDs, want 60", len(bar))
+	}
+
+	lit := 0.0
+	for _, x := range bar {
+		lit += x
+	}
+
+	if math.Abs(lit-30) > 1 {
+		t.Errorf("%.1f LEDs are lit, want 30", lit)
+	}
+}
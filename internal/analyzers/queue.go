@@ -1,60 +1,207 @@
 package analyzers
 
 import (
+	"github.com/ivkos/luxaudio/internal/beat"
 	"github.com/ivkos/luxaudio/internal/effects"
-	"log"
 )
 
 type PayloadSender = func(ledData []byte)
 
+// the buffer holds this many chunks, so that a slow send doesn't immediately cost samples
+const queueChunks = 8
+
 type Queue struct {
-	fftSize     int
-	analyzer    *Analyzer
-	effect      *effects.Effect
-	sampleQueue []float64
+	fftSize  int
+	hopSize  int
+	channels int
+	analyzer *Analyzer
+	effect   *effects.Effect
+	filter   *FilterChain
+	gate     *SilenceGate
+	agc      *AGC
+	detector *beat.Detector
+
+	samples  *RingBuffer
+	lossless bool
+	notify   chan struct{}
+	consumed chan struct{}
+	drained  chan chan struct{}
+	idle     chan struct{}
+	hop      []float64
+	window   []float64
+	analysis []float64
 
 	sender *PayloadSender
 }
 
-func NewQueue(fftSize int, analyzer *Analyzer, effect *effects.Effect, sender *PayloadSender) *Queue {
-	return &Queue{
-		fftSize:     fftSize,
-		analyzer:    analyzer,
-		effect:      effect,
-		sampleQueue: make([]float64, 0),
-		sender:      sender,
+// NewQueue creates a queue of interleaved samples which are analyzed on a dedicated goroutine,
+// so that analysis and sending never block the audio callback. Every hopSize frames, the latest
+// fftSize frames are analyzed, so the windows overlap when hopSize is smaller than fftSize.
+// A lossless queue makes Enqueue wait for room instead, for inputs that can wait, like files.
+// The filter chain, the silence gate, the AGC and the beat detector are optional.
+func NewQueue(
+	fftSize int,
+	hopSize int,
+	channels int,
+	lossless bool,
+	analyzer *Analyzer,
+	effect *effects.Effect,
+	filter *FilterChain,
+	gate *SilenceGate,
+	agc *AGC,
+	detector *beat.Detector,
+	sender *PayloadSender,
+) *Queue {
+	chunkSize := fftSize * channels
+
+	q := &Queue{
+		fftSize:  fftSize,
+		hopSize:  hopSize,
+		channels: channels,
+		analyzer: analyzer,
+		effect:   effect,
+		filter:   filter,
+		gate:     gate,
+		agc:      agc,
+		detector: detector,
+
+		samples:  NewRingBuffer(chunkSize * queueChunks),
+		lossless: lossless,
+		notify:   make(chan struct{}, 1),
+		consumed: make(chan struct{}, 1),
+		drained:  make(chan chan struct{}, 1),
+		idle:     make(chan struct{}, 1),
+		hop:      make([]float64, hopSize*channels),
+		window:   make([]float64, chunkSize),
+		analysis: make([]float64, chunkSize),
+
+		sender: sender,
 	}
+
+	go q.work()
+
+	return q
 }
 
 func (q *Queue) Size() int {
-	return len(q.sampleQueue)
+	return q.samples.Size()
 }
 
-func (q *Queue) Enqueue(monoFloats []float64, recursiveCall bool) {
-	q.sampleQueue = append(q.sampleQueue, monoFloats...)
+func (q *Queue) Dropped() uint64 {
+	return q.samples.Dropped()
+}
 
-	if len(q.sampleQueue) < q.fftSize {
+// Enqueue copies the samples into the queue. Unless the queue is lossless, it never blocks
+// and drops the oldest samples if the queue is full.
+func (q *Queue) Enqueue(samples []float64) {
+	if !q.lossless {
+		q.samples.Write(samples)
+		signal(q.notify)
 		return
 	}
 
-	if recursiveCall {
-		log.Printf("Leftover samples")
+	for len(samples) > 0 {
+		n := len(samples)
+		if n > len(q.window) {
+			n = len(q.window)
+		}
+
+		for q.samples.Capacity()-q.samples.Size() < n {
+			<-q.consumed
+		}
+
+		q.samples.Write(samples[:n])
+		signal(q.notify)
+
+		samples = samples[n:]
+	}
+}
+
+// Drain waits until every complete hop in the queue has been processed
+func (q *Queue) Drain() {
+	done := make(chan struct{})
+	q.drained <- done
+	signal(q.notify)
+
+	<-done
+}
+
+// Idle processes a hop of silence, unless samples are waiting. It's meant to be called once per hop
+// while no audio arrives at all, e.g. while the audio device is lost, so that the silence gate still
+// switches to the idle effect.
+func (q *Queue) Idle() {
+	signal(q.idle)
+}
+
+func (q *Queue) work() {
+	for {
+		select {
+		case <-q.notify:
+			for q.samples.Read(q.hop) {
+				q.process()
+				signal(q.consumed)
+			}
+
+			select {
+			case done := <-q.drained:
+				close(done)
+			default:
+			}
+
+		case <-q.idle:
+			if q.samples.Size() == 0 {
+				for i := range q.hop {
+					q.hop[i] = 0
+				}
+				q.process()
+			}
+		}
+	}
+}
+
+func (q *Queue) process() {
+	if q.filter != nil {
+		q.filter.Process(q.hop)
 	}
 
-	// get our chunk
-	sampleChunk := q.sampleQueue[:q.fftSize]
+	// the gate sees the actual level, before the AGC boosts it
+	if q.gate != nil {
+		q.gate.Observe(q.hop)
+	}
 
-	// analyze
-	intensities := (*(q.analyzer)).Analyze(sampleChunk)
+	if q.agc != nil {
+		q.agc.Process(q.hop)
+	}
 
-	// remove analyzed chunk
-	q.sampleQueue = q.sampleQueue[q.fftSize:]
+	// slide the window by a hop
+	copy(q.window, q.window[len(q.hop):])
+	copy(q.window[len(q.window)-len(q.hop):], q.hop)
+
+	// beat listeners are called before the effect is applied
+	if q.detector != nil {
+		q.detector.Process(q.window)
+	}
+
+	// analyze a copy, since analyzers may modify it in place
+	copy(q.analysis, q.window)
+	intensities := (*(q.analyzer)).Analyze(q.analysis)
 
 	// apply effect
 	ledData := (*(q.effect)).Apply(intensities)
 
+	if q.gate != nil {
+		ledData = q.gate.Apply(ledData)
+	}
+
 	// send the payload
-	(*(q.sender))(ledData)
+	if ledData != nil {
+		(*(q.sender))(ledData)
+	}
+}
 
-	q.Enqueue([]float64{}, true)
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
 }
@@ -0,0 +1,100 @@
+package analyzers
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// RingBuffer is a lock-free single producer, single consumer queue of samples with a fixed capacity.
+// When the consumer falls behind, the producer drops the oldest samples to make room.
+type RingBuffer struct {
+	// accessed atomically, kept first for 64-bit alignment on 32-bit platforms
+	writePos uint64
+	readPos  uint64
+	dropped  uint64
+
+	// the bits of the samples, accessed atomically, since the producer may overwrite
+	// samples that the consumer is copying when it drops them
+	data []uint64
+	mask uint64
+}
+
+func NewRingBuffer(minCapacity int) *RingBuffer {
+	capacity := 1
+	for capacity < minCapacity {
+		capacity <<= 1
+	}
+
+	return &RingBuffer{
+		data: make([]uint64, capacity),
+		mask: uint64(capacity - 1),
+	}
+}
+
+func (rb *RingBuffer) Capacity() int {
+	return len(rb.data)
+}
+
+// Size is the number of samples waiting to be read
+func (rb *RingBuffer) Size() int {
+	return int(atomic.LoadUint64(&rb.writePos) - atomic.LoadUint64(&rb.readPos))
+}
+
+// Dropped is the total number of samples dropped because the buffer was full
+func (rb *RingBuffer) Dropped() uint64 {
+	return atomic.LoadUint64(&rb.dropped)
+}
+
+// Write must only be called by the producer
+func (rb *RingBuffer) Write(samples []float64) {
+	capacity := uint64(len(rb.data))
+
+	if uint64(len(samples)) > capacity {
+		atomic.AddUint64(&rb.dropped, uint64(len(samples))-capacity)
+		samples = samples[uint64(len(samples))-capacity:]
+	}
+
+	w := atomic.LoadUint64(&rb.writePos)
+	end := w + uint64(len(samples))
+
+	// make room by moving the reader past the oldest samples, before overwriting them
+	for {
+		r := atomic.LoadUint64(&rb.readPos)
+		if end-r <= capacity {
+			break
+		}
+
+		if atomic.CompareAndSwapUint64(&rb.readPos, r, end-capacity) {
+			atomic.AddUint64(&rb.dropped, end-capacity-r)
+			break
+		}
+	}
+
+	for i, x := range samples {
+		atomic.StoreUint64(&rb.data[(w+uint64(i))&rb.mask], math.Float64bits(x))
+	}
+
+	atomic.StoreUint64(&rb.writePos, end)
+}
+
+// Read fills dst if enough samples are available and tells whether it did. It must only be called by the consumer.
+func (rb *RingBuffer) Read(dst []float64) bool {
+	n := uint64(len(dst))
+
+	for {
+		r := atomic.LoadUint64(&rb.readPos)
+		w := atomic.LoadUint64(&rb.writePos)
+		if w-r < n {
+			return false
+		}
+
+		for i := range dst {
+			dst[i] = math.Float64frombits(atomic.LoadUint64(&rb.data[(r+uint64(i))&rb.mask]))
+		}
+
+		// if the producer dropped samples meanwhile, what was copied may have been overwritten
+		if atomic.CompareAndSwapUint64(&rb.readPos, r, r+n) {
+			return true
+		}
+	}
+}
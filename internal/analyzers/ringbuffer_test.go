@@ -0,0 +1,167 @@
+package analyzers
+
+import (
+	"sync"
+	"testing"
+)
+
+func sequence(from int, n int) []float64 {
+	r := make([]float64, n)
+	for i := range r {
+		r[i] = float64(from + i)
+	}
+
+	return r
+}
+
+func assertSequence(t *testing.T, got []float64, from int) {
+	t.Helper()
+
+	for i, x := range got {
+		if x != float64(from+i) {
+			t.Fatalf("got %v, want a sequence from %d", got, from)
+		}
+	}
+}
+
+func TestRingBufferCapacityIsPowerOfTwo(t *testing.T) {
+	if c := NewRingBuffer(100).Capacity(); c != 128 {
+		t.Errorf("capacity = %d, want 128", c)
+	}
+}
+
+func TestRingBufferWrapsAround(t *testing.T) {
+	rb := NewRingBuffer(8)
+	dst := make([]float64, 3)
+
+	// every write and read crosses the end of the buffer at some point
+	next := 0
+	for i := 0; i < 20; i++ {
+		rb.Write(sequence(next, 3))
+
+		if !rb.Read(dst) {
+			t.Fatalf("read %d failed", i)
+		}
+		assertSequence(t, dst, next)
+
+		next += 3
+	}
+
+	if rb.Size() != 0 || rb.Dropped() != 0 {
+		t.Errorf("size = %d, dropped = %d, want 0 and 0", rb.Size(), rb.Dropped())
+	}
+}
+
+func TestRingBufferReadFailsOnShortData(t *testing.T) {
+	rb := NewRingBuffer(8)
+	rb.Write(sequence(0, 3))
+
+	dst := []float64{-1, -1, -1, -1}
+	if rb.Read(dst) {
+		t.Fatal("read of 4 samples succeeded with 3 available")
+	}
+
+	for _, x := range dst {
+		if x != -1 {
+			t.Fatalf("failed read modified dst: %v", dst)
+		}
+	}
+
+	if rb.Size() != 3 {
+		t.Errorf("size = %d, want 3", rb.Size())
+	}
+
+	if !rb.Read(dst[:3]) {
+		t.Fatal("read of 3 samples failed")
+	}
+	assertSequence(t, dst[:3], 0)
+}
+
+func TestRingBufferDropsOldest(t *testing.T) {
+	rb := NewRingBuffer(8)
+
+	rb.Write(sequence(0, 6))
+	rb.Write(sequence(6, 5))
+
+	if rb.Dropped() != 3 || rb.Size() != 8 {
+		t.Fatalf("dropped = %d, size = %d, want 3 and 8", rb.Dropped(), rb.Size())
+	}
+
+	dst := make([]float64, 8)
+	if !rb.Read(dst) {
+		t.Fatal("read failed")
+	}
+	assertSequence(t, dst, 3)
+
+	// a write larger than the buffer keeps only its newest samples
+	rb.Write(sequence(100, 20))
+
+	if rb.Dropped() != 3+12 {
+		t.Fatalf("dropped = %d, want 15", rb.Dropped())
+	}
+
+	if !rb.Read(dst) {
+		t.Fatal("read failed")
+	}
+	assertSequence(t, dst, 112)
+}
+
+// TestRingBufferConcurrent is meant to be run with -race. The consumer must only ever see
+// consecutive samples within a read, however many samples the producer drops meanwhile.
+func TestRingBufferConcurrent(t *testing.T) {
+	const (
+		total = 48 << 15
+		chunk = 48
+		hop   = 64
+	)
+
+	rb := NewRingBuffer(256)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		for next := 0; next < total; next += chunk {
+			rb.Write(sequence(next, chunk))
+		}
+	}()
+
+	dst := make([]float64, hop)
+	read := 0
+	last := -1.0
+
+	consume := func() {
+		for rb.Read(dst) {
+			if dst[0] <= last {
+				t.Fatalf("read %v after %v", dst[0], last)
+			}
+			assertSequence(t, dst, int(dst[0]))
+
+			last = dst[len(dst)-1]
+			read += len(dst)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+
+		consume()
+	}
+	consume()
+
+	if written := uint64(read+rb.Size()) + rb.Dropped(); written != total {
+		t.Errorf("read %d + left %d + dropped %d = %d, want %d", read, rb.Size(), rb.Dropped(), written, total)
+	}
+}
@@ -0,0 +1,118 @@
+package analyzers
+
+import (
+	"github.com/ivkos/luxaudio/internal/effects"
+	"math"
+	"time"
+)
+
+// SilenceGate switches to an idle effect once the input has been silent for a while,
+// sending it at a lower rate, and fades back to the audio-reactive effect when sound returns.
+type SilenceGate struct {
+	threshold   float64
+	holdSamples int
+
+	silentSamples int
+
+	idleEffect *effects.IdleEffect
+	fadeTime   time.Duration
+
+	// 1 is fully audio-reactive, 0 is fully idle
+	level      float64
+	lastUpdate time.Time
+	lastSent   time.Time
+
+	blended []byte
+}
+
+func NewSilenceGate(
+	dbfsThreshold float64,
+	hold time.Duration,
+	sampleRate float64,
+	channels int,
+	idleEffect *effects.IdleEffect,
+	fadeTime time.Duration,
+) *SilenceGate {
+	return &SilenceGate{
+		threshold:   math.Pow(10, dbfsThreshold/20),
+		holdSamples: int(hold.Seconds() * sampleRate * float64(channels)),
+
+		idleEffect: idleEffect,
+		fadeTime:   fadeTime,
+
+		level:      1,
+		lastUpdate: time.Now(),
+	}
+}
+
+// Observe must be given the samples of every chunk before they are analyzed
+func (g *SilenceGate) Observe(samples []float64) {
+	sum := 0.0
+	for _, x := range samples {
+		sum += x * x
+	}
+
+	rms := math.Sqrt(sum / float64(len(samples)))
+	if rms < g.threshold {
+		if g.silentSamples < g.holdSamples {
+			g.silentSamples += len(samples)
+		}
+	} else {
+		g.silentSamples = 0
+	}
+}
+
+func (g *SilenceGate) IsIdle() bool {
+	return g.silentSamples >= g.holdSamples
+}
+
+// Apply returns what should be sent instead of ledData, or nil if nothing should be sent for this chunk
+func (g *SilenceGate) Apply(ledData []byte) []byte {
+	now := time.Now()
+	elapsed := now.Sub(g.lastUpdate)
+	g.lastUpdate = now
+
+	target := 1.0
+	if g.IsIdle() {
+		target = 0
+	}
+
+	if g.level == 1 && target == 0 {
+		g.idleEffect.Restart()
+	}
+
+	step := 1.0
+	if g.fadeTime > 0 {
+		step = float64(elapsed) / float64(g.fadeTime)
+	}
+
+	if g.level < target {
+		g.level = math.Min(target, g.level+step)
+	} else {
+		g.level = math.Max(target, g.level-step)
+	}
+
+	if g.level == 1 {
+		return ledData
+	}
+
+	idleData := g.idleEffect.Apply(nil)
+	if g.level == 0 {
+		if now.Sub(g.lastSent) < g.idleEffect.Interval() {
+			return nil
+		}
+
+		g.lastSent = now
+		return idleData
+	}
+
+	if len(g.blended) != len(ledData) {
+		g.blended = make([]byte, len(ledData))
+	}
+
+	for i := range g.blended {
+		g.blended[i] = byte(float64(idleData[i])*(1-g.level) + float64(ledData[i])*g.level)
+	}
+
+	return g.blended
+}
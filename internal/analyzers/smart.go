@@ -22,10 +22,14 @@ type SmartAnalyzer struct {
 	decayFactor   float64
 	dbfsThreshold float64
 
-	window []float64
-	fft    *fourier.FFT
+	window    []float64
+	reference float64
+	fft       *fourier.FFT
 
 	mirror bool
+
+	// nil for linear bands
+	bands *bandMapper
 }
 
 func NewSmartAnalyzer(
@@ -37,11 +41,28 @@ func NewSmartAnalyzer(
 	audibleLow float64,
 	audibleHigh float64,
 	mirror bool,
+	bandScale BandScale,
+	windowFunc WindowFunc,
 ) Analyzer {
 	intensitiesLength := fftSize/2 + 1
 
 	freqs := calculateFreqs(intensitiesLength, sampleRate, fftSize)
 
+	var bands *bandMapper
+	if bandScale != LinearBands {
+		bandCount := ledCount
+		if mirror {
+			bandCount = ledCount / 2
+		}
+		if bandCount < 1 {
+			bandCount = 1
+		}
+
+		bands = newBandMapper(bandScale, bandCount, audibleLow, audibleHigh, sampleRate/float64(fftSize), intensitiesLength)
+	}
+
+	window := windowFunc(fftSize)
+
 	return &SmartAnalyzer{
 		fftSize:    fftSize,
 		ledCount:   ledCount,
@@ -56,10 +77,13 @@ func NewSmartAnalyzer(
 		decayFactor:   decayFactor,
 		dbfsThreshold: dbfsThreshold,
 
-		window: getHannWindow(fftSize),
-		fft:    fourier.NewFFT(fftSize),
+		window:    window,
+		reference: windowReference(window),
+		fft:       fourier.NewFFT(fftSize),
 
 		mirror: mirror,
+
+		bands: bands,
 	}
 }
 
@@ -71,17 +95,15 @@ func (sa *SmartAnalyzer) Analyze(sampleChunk []float64) []float64 {
 		x := ffs[i]
 		magnitude := cmplx.Abs(x)
 
-		db := 20 * math.Log10(magnitude/(float64(sa.fftSize)/4))
-		newIntensity := math.Min((math.Max(sa.dbfsThreshold, db)-sa.dbfsThreshold)/-sa.dbfsThreshold, 1)
-
-		if sa.decayFactor != float64(0) && newIntensity <= sa.intensities[i] {
-			sa.intensities[i] *= sa.decayFactor
-		} else {
-			sa.intensities[i] = newIntensity
-		}
+		db := 20 * math.Log10(magnitude/sa.reference)
+		sa.intensities[i] = decayIntensity(sa.intensities[i], dbToIntensity(db, sa.dbfsThreshold), sa.decayFactor)
 	}
 
 	result := sa.intensities[sa.loF : sa.hiF+1]
+	if sa.bands != nil {
+		result = sa.bands.Map(sa.intensities)
+	}
+
 	if sa.mirror {
 		result = mirrorResult(result)
 	}
@@ -92,12 +114,31 @@ func (sa *SmartAnalyzer) Analyze(sampleChunk []float64) []float64 {
 	return result
 }
 
+// dbToIntensity maps levels from dbfsThreshold to 0 dBFS to [0, 1]
+func dbToIntensity(db float64, dbfsThreshold float64) float64 {
+	return math.Min((math.Max(dbfsThreshold, db)-dbfsThreshold)/-dbfsThreshold, 1)
+}
+
+// decayIntensity lets the previous intensity decay unless the new one is higher
+func decayIntensity(previous float64, next float64, decayFactor float64) float64 {
+	if decayFactor != float64(0) && next <= previous {
+		return previous * decayFactor
+	}
+
+	return next
+}
+
 func mirrorResult(original []float64) []float64 {
-	reversed := append([]float64{}, original...)
+	return joinMirrored(original, original)
+}
+
+// joinMirrored lays out left reversed followed by right, so that both start at the middle
+func joinMirrored(left []float64, right []float64) []float64 {
+	reversed := append([]float64{}, left...)
 	floats.Reverse(reversed)
 
 	result := append([]float64{}, reversed...)
-	result = append(result, original...)
+	result = append(result, right...)
 
 	return result
 }
@@ -130,19 +171,3 @@ func calculateFreqs(size int, sampleRate float64, fftSize int) []float64 {
 	}
 	return freqs
 }
-
-func getHannWindow(size int) []float64 {
-	r := make([]float64, size)
-
-	if size == 1 {
-		r[0] = 1
-	} else {
-		N := size - 1
-		coef := 2 * math.Pi / float64(N)
-		for n := 0; n <= N; n++ {
-			r[n] = 0.5 * (1 - math.Cos(coef*float64(n)))
-		}
-	}
-
-	return r
-}
@@ -0,0 +1,42 @@
+package analyzers
+
+import "fmt"
+
+type StereoAnalyzer struct {
+	left  Analyzer
+	right Analyzer
+
+	leftSamples  []float64
+	rightSamples []float64
+}
+
+// NewStereoAnalyzer analyzes interleaved left and right samples separately and lays them out
+// mirrored from the middle: the left channel on the left half, the right channel on the right half.
+// Every half needs at least one LED.
+func NewStereoAnalyzer(ledCount int, newAnalyzer func(ledCount int) Analyzer) (Analyzer, error) {
+	if ledCount < 2 {
+		return nil, fmt.Errorf("stereo requires at least 2 LEDs, got %d", ledCount)
+	}
+
+	return &StereoAnalyzer{
+		left:  newAnalyzer(ledCount / 2),
+		right: newAnalyzer(ledCount - ledCount/2),
+
+		leftSamples:  make([]float64, 0),
+		rightSamples: make([]float64, 0),
+	}, nil
+}
+
+func (sa *StereoAnalyzer) Analyze(sampleChunk []float64) []float64 {
+	frames := len(sampleChunk) / 2
+
+	sa.leftSamples = sa.leftSamples[:0]
+	sa.rightSamples = sa.rightSamples[:0]
+
+	for i := 0; i < frames; i++ {
+		sa.leftSamples = append(sa.leftSamples, sampleChunk[i*2+0])
+		sa.rightSamples = append(sa.rightSamples, sampleChunk[i*2+1])
+	}
+
+	return joinMirrored(sa.left.Analyze(sa.leftSamples), sa.right.Analyze(sa.rightSamples))
+}
@@ -0,0 +1,31 @@
+package analyzers
+
+import (
+	"github.com/ivkos/luxaudio/internal/utils"
+	"testing"
+)
+
+func newTestSmartAnalyzer(ledCount int) Analyzer {
+	return NewSmartAnalyzer(1024, ledCount, 44100, 0.5, -96, 20, 20000, false, LinearBands, utils.GetHannWindow)
+}
+
+func TestStereoAnalyzerRequiresTwoLeds(t *testing.T) {
+	for _, ledCount := range []int{0, 1} {
+		if _, err := NewStereoAnalyzer(ledCount, newTestSmartAnalyzer); err == nil {
+			t.Errorf("stereo analyzer with %d LEDs was created", ledCount)
+		}
+	}
+}
+
+func TestStereoAnalyzerSplitsLeds(t *testing.T) {
+	for _, ledCount := range []int{2, 3, 120} {
+		analyzer, err := NewStereoAnalyzer(ledCount, newTestSmartAnalyzer)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := len(analyzer.Analyze(make([]float64, 2048))); got != ledCount {
+			t.Errorf("%d LEDs: got %d intensities", ledCount, got)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package analyzers
+
+import (
+	"fmt"
+	"github.com/ivkos/luxaudio/internal/utils"
+	"math"
+)
+
+// WindowFunc returns a window of the given size
+type WindowFunc = func(size int) []float64
+
+// ParseWindow returns the window function with the given name. kaiserBeta is only used by the kaiser window.
+func ParseWindow(name string, kaiserBeta float64) (WindowFunc, error) {
+	switch name {
+	case "rectangular":
+		return getRectangularWindow, nil
+	case "hann":
+		return utils.GetHannWindow, nil
+	case "hamming":
+		return cosineWindow(0.54, 0.46), nil
+	case "blackman":
+		return cosineWindow(0.42, 0.5, 0.08), nil
+	case "blackman-harris":
+		return cosineWindow(0.35875, 0.48829, 0.14128, 0.01168), nil
+	case "nuttall":
+		return cosineWindow(0.355768, 0.487396, 0.144232, 0.012604), nil
+	case "flattop":
+		return cosineWindow(0.21557895, 0.41663158, 0.277263158, 0.083578947, 0.006947368), nil
+	case "kaiser":
+		return func(size int) []float64 {
+			return getKaiserWindow(size, kaiserBeta)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported window: %s", name)
+	}
+}
+
+// windowReference is the magnitude of the FFT bin of a full scale sine after applying the window
+func windowReference(window []float64) float64 {
+	sum := 0.0
+	for _, w := range window {
+		sum += w
+	}
+
+	return sum / 2
+}
+
+func getRectangularWindow(size int) []float64 {
+	r := make([]float64, size)
+	for n := range r {
+		r[n] = 1
+	}
+
+	return r
+}
+
+// cosineWindow returns a sum of cosines with alternating signs, a0 - a1 cos(x) + a2 cos(2x) - ...
+func cosineWindow(coefficients ...float64) WindowFunc {
+	return func(size int) []float64 {
+		r := make([]float64, size)
+
+		if size == 1 {
+			r[0] = 1
+			return r
+		}
+
+		N := size - 1
+		coef := 2 * math.Pi / float64(N)
+		for n := 0; n <= N; n++ {
+			sign := 1.0
+			for k, a := range coefficients {
+				r[n] += sign * a * math.Cos(coef*float64(k*n))
+				sign = -sign
+			}
+		}
+
+		return r
+	}
+}
+
+func getKaiserWindow(size int, beta float64) []float64 {
+	r := make([]float64, size)
+
+	if size == 1 {
+		r[0] = 1
+		return r
+	}
+
+	N := size - 1
+	for n := 0; n <= N; n++ {
+		x := 2*float64(n)/float64(N) - 1
+		r[n] = besselI0(beta*math.Sqrt(1-x*x)) / besselI0(beta)
+	}
+
+	return r
+}
+
+// besselI0 is the modified Bessel function of the first kind of order 0, by its power series
+func besselI0(x float64) float64 {
+	sum := 1.0
+	term := 1.0
+	for k := 1; term > sum*1e-12; k++ {
+		term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+		sum += term
+	}
+
+	return sum
+}
@@ -0,0 +1,106 @@
+package analyzers
+
+import (
+	"gonum.org/v1/gonum/dsp/fourier"
+	"gonum.org/v1/gonum/floats"
+	"math"
+	"math/cmplx"
+	"testing"
+)
+
+var windows = []struct {
+	name string
+	// how much lower a sine between two bins reads than one at a bin, in dB
+	scallopingLoss float64
+}{
+	{"rectangular", 3.92},
+	{"hann", 1.42},
+	{"hamming", 1.75},
+	{"blackman", 1.10},
+	{"blackman-harris", 0.83},
+	{"nuttall", 0.81},
+	{"flattop", 0.01},
+	{"kaiser", 1.11},
+}
+
+func parseTestWindow(t *testing.T, name string) WindowFunc {
+	windowFunc, err := ParseWindow(name, 8.6)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return windowFunc
+}
+
+func TestWindowShape(t *testing.T) {
+	for _, w := range windows {
+		for _, size := range []int{1, 2, 1023, 1024} {
+			window := parseTestWindow(t, w.name)(size)
+
+			if len(window) != size {
+				t.Fatalf("%s: got %d points, want %d", w.name, len(window), size)
+			}
+
+			for n := range window {
+				if math.Abs(window[n]-window[size-1-n]) > 1e-12 {
+					t.Errorf("%s, %d points: not symmetric at %d", w.name, size, n)
+					break
+				}
+			}
+
+			if size%2 == 1 {
+				if peak := window[size/2]; math.Abs(peak-1) > 1e-6 {
+					t.Errorf("%s, %d points: peaks at %v, want 1", w.name, size, peak)
+				}
+			}
+		}
+	}
+}
+
+func TestWindowReadsFullScaleSine(t *testing.T) {
+	const fftSize = 1024
+	fft := fourier.NewFFT(fftSize)
+
+	for _, w := range windows {
+		window := parseTestWindow(t, w.name)(fftSize)
+
+		// in bins, so that the sample rate doesn't matter
+		for _, freq := range []float64{100, 100.5} {
+			samples := sine(fftSize, freq, fftSize, 1)
+			floats.Mul(samples, window)
+			coefficients := fft.Coefficients(nil, samples)
+
+			magnitude := math.Max(cmplx.Abs(coefficients[100]), cmplx.Abs(coefficients[101]))
+			db := 20 * math.Log10(magnitude/windowReference(window))
+
+			want := 0.0
+			if freq != math.Trunc(freq) {
+				want = -w.scallopingLoss
+			}
+
+			if math.Abs(db-want) > 0.02 {
+				t.Errorf("%s: a full scale sine at bin %v reads %.3f dBFS, want %.2f dBFS", w.name, freq, db, want)
+			}
+		}
+	}
+}
+
+func TestSmartAnalyzerLevelUnderEveryWindow(t *testing.T) {
+	const (
+		fftSize    = 1024
+		sampleRate = 44100
+		binCount   = fftSize/2 + 1
+	)
+
+	for _, w := range windows {
+		// one LED per bin, from DC to Nyquist, so that the peak bin can be read off
+		analyzer := NewSmartAnalyzer(fftSize, binCount, sampleRate, 0, -96, 0, sampleRate/2, false, LinearBands, parseTestWindow(t, w.name))
+		result := analyzer.Analyze(sine(fftSize, 100*sampleRate/fftSize, sampleRate, 0.5))
+
+		// -6 dBFS on a scale from -96 to 0 dBFS
+		want := (96 + 20*math.Log10(0.5)) / 96
+		if got := floats.Max(result); math.Abs(got-want) > 0.001 {
+			t.Errorf("%s: a -6 dBFS sine reads %v, want %v", w.name, got, want)
+		}
+	}
+}
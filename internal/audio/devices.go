@@ -0,0 +1,189 @@
+package audio
+
+import (
+	"fmt"
+	"github.com/gen2brain/malgo"
+	"io"
+	"strings"
+)
+
+type DeviceInfo struct {
+	ID   string
+	Name string
+
+	Formats []Format
+
+	MinChannels   int
+	MaxChannels   int
+	MinSampleRate int
+	MaxSampleRate int
+
+	id malgo.DeviceID
+}
+
+func PrintDevices(w io.Writer, backend string) error {
+	malgoBackend, err := getBackend(backend)
+	if err != nil {
+		return err
+	}
+
+	context, err := initContext(malgoBackend)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = context.Uninit()
+		context.Free()
+	}()
+
+	_, _ = fmt.Fprintf(w, "Backend: %s\n", backendName(malgoBackend))
+
+	for _, kind := range []struct {
+		title string
+		kind  malgo.DeviceType
+	}{
+		{"Capture devices (--device capture)", malgo.Capture},
+		{"Playback devices (--device loopback)", malgo.Playback},
+	} {
+		devices, err := listDevices(context, kind.kind)
+		if err != nil {
+			return err
+		}
+
+		_, _ = fmt.Fprintf(w, "\n%s:\n", kind.title)
+		if len(devices) == 0 {
+			_, _ = fmt.Fprintln(w, "  none")
+		}
+
+		for _, d := range devices {
+			_, _ = fmt.Fprintf(w, "  %s\n", d.Name)
+			_, _ = fmt.Fprintf(w, "    ID:           %s\n", d.ID)
+			_, _ = fmt.Fprintf(w, "    Formats:      %s\n", formatList(d.Formats))
+			_, _ = fmt.Fprintf(w, "    Channels:     %s\n", formatRange(d.MinChannels, d.MaxChannels))
+			_, _ = fmt.Fprintf(w, "    Sample rates: %s\n", formatRange(d.MinSampleRate, d.MaxSampleRate))
+		}
+	}
+
+	return nil
+}
+
+func listDevices(context *malgo.AllocatedContext, kind malgo.DeviceType) ([]DeviceInfo, error) {
+	infos, err := context.Devices(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]DeviceInfo, len(infos))
+	for i, info := range infos {
+		formats := make([]Format, 0)
+		for j := 0; j < int(info.FormatCount) && j < len(info.Formats); j++ {
+			if f := fromMalgoFormat(malgo.FormatType(info.Formats[j])); f != FormatUnknown {
+				formats = append(formats, f)
+			}
+		}
+
+		devices[i] = DeviceInfo{
+			ID:   info.ID.String(),
+			Name: strings.TrimRight(info.Name(), "\x00"),
+
+			Formats: formats,
+
+			MinChannels:   int(info.MinChannels),
+			MaxChannels:   int(info.MaxChannels),
+			MinSampleRate: int(info.MinSampleRate),
+			MaxSampleRate: int(info.MaxSampleRate),
+
+			id: info.ID,
+		}
+	}
+
+	return devices, nil
+}
+
+// findDevice looks a device up by its exact ID or a case-insensitive substring of its name.
+// A nil result means the backend's default device should be used.
+func findDevice(context *malgo.AllocatedContext, kind malgo.DeviceType, id string, name string) (*malgo.DeviceID, error) {
+	if id == "" && name == "" {
+		return nil, nil
+	}
+
+	devices, err := listDevices(context, kind)
+	if err != nil {
+		return nil, err
+	}
+
+	if id != "" {
+		for _, d := range devices {
+			if strings.EqualFold(d.ID, id) {
+				return &d.id, nil
+			}
+		}
+
+		return nil, fmt.Errorf("no device with ID %s", id)
+	}
+
+	matches := make([]DeviceInfo, 0)
+	for _, d := range devices {
+		if strings.EqualFold(d.Name, name) {
+			return &d.id, nil
+		}
+
+		if strings.Contains(strings.ToLower(d.Name), strings.ToLower(name)) {
+			matches = append(matches, d)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no device name contains %q", name)
+
+	case 1:
+		return &matches[0].id, nil
+
+	default:
+		names := make([]string, len(matches))
+		for i, d := range matches {
+			names[i] = fmt.Sprintf("%q", d.Name)
+		}
+		return nil, fmt.Errorf("%q matches several devices: %s", name, strings.Join(names, ", "))
+	}
+}
+
+func backendName(backend malgo.Backend) string {
+	switch backend {
+	case malgo.BackendAlsa:
+		return "alsa"
+	case malgo.BackendPulseaudio:
+		return "pulse"
+	case malgo.BackendJack:
+		return "jack"
+	case malgo.BackendWasapi:
+		return "wasapi"
+	default:
+		return "unknown"
+	}
+}
+
+func formatList(formats []Format) string {
+	if len(formats) == 0 {
+		return "unknown"
+	}
+
+	names := make([]string, len(formats))
+	for i, f := range formats {
+		names[i] = f.String()
+	}
+
+	return strings.Join(names, ", ")
+}
+
+func formatRange(min int, max int) string {
+	switch {
+	case min == 0 && max == 0:
+		return "unknown"
+	case min == max:
+		return fmt.Sprintf("%d", min)
+	default:
+		return fmt.Sprintf("%d-%d", min, max)
+	}
+}
@@ -0,0 +1,138 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+type Format int
+
+const (
+	FormatUnknown Format = iota
+	FormatU8
+	FormatS16
+	FormatS24
+	FormatS32
+	FormatF32
+)
+
+func (f Format) BytesPerSample() int {
+	switch f {
+	case FormatU8:
+		return 1
+	case FormatS16:
+		return 2
+	case FormatS24:
+		return 3
+	case FormatS32, FormatF32:
+		return 4
+	default:
+		return 0
+	}
+}
+
+func (f Format) String() string {
+	switch f {
+	case FormatU8:
+		return "u8"
+	case FormatS16:
+		return "s16"
+	case FormatS24:
+		return "s24"
+	case FormatS32:
+		return "s32"
+	case FormatF32:
+		return "f32"
+	default:
+		return "unknown"
+	}
+}
+
+type sampleDecoder = func(b []byte) float64
+
+// decodeSample converts a single little-endian sample of any format into a float in [-1, 1]
+func decodeSample(format Format, b []byte) float64 {
+	return decoderFor(format)(b)
+}
+
+// decoderFor picks the decoder once, so that hot loops don't have to switch on the format for every sample
+func decoderFor(format Format) sampleDecoder {
+	switch format {
+	case FormatU8:
+		return decodeU8
+	case FormatS16:
+		return decodeS16
+	case FormatS24:
+		return decodeS24
+	case FormatS32:
+		return decodeS32
+	case FormatF32:
+		return decodeF32
+	default:
+		return func(_ []byte) float64 { return 0 }
+	}
+}
+
+func decodeU8(b []byte) float64 {
+	return (float64(b[0]) - 128) / 128
+}
+
+func decodeS16(b []byte) float64 {
+	return float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15)
+}
+
+func decodeS24(b []byte) float64 {
+	// shift into the top of an int32 and back to sign-extend
+	v := int32(uint32(b[0])<<8 | uint32(b[1])<<16 | uint32(b[2])<<24)
+	return float64(v>>8) / (1 << 23)
+}
+
+func decodeS32(b []byte) float64 {
+	return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31)
+}
+
+func decodeF32(b []byte) float64 {
+	return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+}
+
+// encodeSample is the inverse of decodeSample, clipping x to [-1, 1]
+func encodeSample(format Format, b []byte, x float64) {
+	x = math.Max(-1, math.Min(1, x))
+
+	switch format {
+	case FormatU8:
+		b[0] = uint8(math.Min(x*128+128, math.MaxUint8))
+
+	case FormatS16:
+		binary.LittleEndian.PutUint16(b, uint16(int16(math.Min(x*(1<<15), math.MaxInt16))))
+
+	case FormatS24:
+		v := uint32(int32(math.Min(x*(1<<23), 1<<23-1)))
+		b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+
+	case FormatS32:
+		binary.LittleEndian.PutUint32(b, uint32(int32(math.Min(x*(1<<31), math.MaxInt32))))
+
+	case FormatF32:
+		binary.LittleEndian.PutUint32(b, math.Float32bits(float32(x)))
+	}
+}
+
+func ParseFormat(s string) (Format, error) {
+	switch strings.TrimSuffix(strings.ToLower(s), "le") {
+	case "u8":
+		return FormatU8, nil
+	case "s16":
+		return FormatS16, nil
+	case "s24":
+		return FormatS24, nil
+	case "s32":
+		return FormatS32, nil
+	case "f32":
+		return FormatF32, nil
+	default:
+		return FormatUnknown, fmt.Errorf("unsupported sample format: %s", s)
+	}
+}
@@ -1,54 +1,114 @@
 package audio
 
 import (
-	"bytes"
-	"encoding/binary"
 	"github.com/ivkos/luxaudio/internal/analyzers"
 	"github.com/ivkos/luxaudio/internal/utils"
+	"sync/atomic"
+	"time"
 )
 
 type FrameReceiver struct {
+	// accessed atomically, kept first for 64-bit alignment on 32-bit platforms
+	lastReceived int64
+
+	format            Format
+	decodeSample      sampleDecoder
 	sampleSizeInBytes int
 	channels          int
+	outputChannels    int
 	queue             *analyzers.Queue
 	pinger            *utils.Pinger
-}
 
-type SampleFormat float32
+	recorder        *Recorder
+	downmixRecorder *Recorder
 
-func NewFrameReceiver(sampleSizeInBytes int, channels int, queue *analyzers.Queue, pinger *utils.Pinger) *FrameReceiver {
+	samples []float64
+}
+
+// NewFrameReceiver creates a receiver that either downmixes to mono (outputChannels = 1) or
+// passes the first two channels on interleaved (outputChannels = 2).
+// The recorders are optional and get the received and the downmixed audio respectively.
+// Without a pinger, the audio is analyzed even while the luxsrv is unreachable.
+func NewFrameReceiver(
+	format Format,
+	channels int,
+	outputChannels int,
+	queue *analyzers.Queue,
+	pinger *utils.Pinger,
+	recorder *Recorder,
+	downmixRecorder *Recorder,
+) *FrameReceiver {
 	return &FrameReceiver{
-		sampleSizeInBytes: sampleSizeInBytes,
+		format:            format,
+		decodeSample:      decoderFor(format),
+		sampleSizeInBytes: format.BytesPerSample(),
 		channels:          channels,
+		outputChannels:    outputChannels,
 		queue:             queue,
 		pinger:            pinger,
+
+		recorder:        recorder,
+		downmixRecorder: downmixRecorder,
 	}
 }
 
 func (fr *FrameReceiver) OnReceive(data []byte, frameCount uint32) {
-	if !fr.pinger.IsReachable {
-		return
+	atomic.StoreInt64(&fr.lastReceived, time.Now().UnixNano())
+
+	samples := fr.decode(data)
+
+	// both recordings get everything, so that they stay in sync
+	if fr.recorder != nil {
+		fr.recorder.Write(data)
+	}
+	if fr.downmixRecorder != nil {
+		fr.downmixRecorder.WriteFloats(samples)
 	}
 
-	convertedData := make([]SampleFormat, len(data)/fr.sampleSizeInBytes)
-	err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &convertedData)
-	utils.CheckErr(err)
+	if fr.pinger != nil && !fr.pinger.IsReachable {
+		return
+	}
 
-	// downsample to mono
-	monoFloats := fr.downsampleToMono(convertedData)
+	// the queue copies the samples, so the buffer can be reused by the next call
+	fr.queue.Enqueue(samples)
+}
 
-	fr.queue.Enqueue(monoFloats, false)
+// SinceLastReceive tells how long ago audio was last received
+func (fr *FrameReceiver) SinceLastReceive() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&fr.lastReceived)))
 }
 
-func (fr *FrameReceiver) downsampleToMono(convertedData []SampleFormat) []float64 {
-	monoFloats := make([]float64, len(convertedData)/fr.channels)
+// decode converts the raw frames straight into the reused sample buffer, either downsampling
+// them to mono or keeping the first two channels
+func (fr *FrameReceiver) decode(data []byte) []float64 {
+	frameSize := fr.sampleSizeInBytes * fr.channels
+	frames := len(data) / frameSize
+
+	if cap(fr.samples) < frames*fr.outputChannels {
+		fr.samples = make([]float64, frames*fr.outputChannels)
+	}
+	samples := fr.samples[:frames*fr.outputChannels]
+
+	if fr.outputChannels == 2 {
+		for i := 0; i < frames; i++ {
+			frame := data[i*frameSize:]
+			samples[i*2+0] = fr.decodeSample(frame)
+			samples[i*2+1] = fr.decodeSample(frame[fr.sampleSizeInBytes:])
+		}
+
+		return samples
+	}
+
+	scale := 1 / float64(fr.channels)
+	for i := 0; i < frames; i++ {
+		frame := data[i*frameSize:]
 
-	for i := range monoFloats {
+		sum := 0.0
 		for j := 0; j < fr.channels; j++ {
-			monoFloats[i] += float64(convertedData[i*fr.channels+j])
+			sum += fr.decodeSample(frame[j*fr.sampleSizeInBytes:])
 		}
-		monoFloats[i] = monoFloats[i] / float64(fr.channels)
+		samples[i] = sum * scale
 	}
 
-	return monoFloats
+	return samples
 }
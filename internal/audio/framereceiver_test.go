@@ -0,0 +1,102 @@
+package audio
+
+import (
+	"fmt"
+	"github.com/ivkos/luxaudio/internal/analyzers"
+	"github.com/ivkos/luxaudio/internal/effects"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// like a 10ms period of a stereo capture device at 48 kHz
+const benchmarkFrames = 480
+
+var benchmarkFormats = []Format{FormatU8, FormatS16, FormatS24, FormatS32, FormatF32}
+
+type constantAnalyzer struct {
+	intensities []float64
+}
+
+func (a *constantAnalyzer) Analyze(_ []float64) []float64 {
+	return a.intensities
+}
+
+type constantEffect struct {
+	ledData []byte
+}
+
+func (e *constantEffect) Apply(_ []float64) []byte {
+	return e.ledData
+}
+
+// newBenchmarkReceiver creates a receiver of stereo input, whose queue analyzes and sends without allocating,
+// so that only the allocations of the receiver are measured
+func newBenchmarkReceiver(format Format, outputChannels int, recorder *Recorder) *FrameReceiver {
+	var analyzer analyzers.Analyzer = &constantAnalyzer{intensities: make([]float64, 10)}
+	var effect effects.Effect = &constantEffect{ledData: make([]byte, 30)}
+	var sender analyzers.PayloadSender = func(ledData []byte) {}
+
+	queue := analyzers.NewQueue(1024, 256, outputChannels, false, &analyzer, &effect, nil, nil, nil, nil, &sender)
+
+	return NewFrameReceiver(format, 2, outputChannels, queue, nil, recorder, nil)
+}
+
+func TestFrameReceiverOnReceiveDoesNotAllocate(t *testing.T) {
+	for _, format := range benchmarkFormats {
+		for _, outputChannels := range []int{1, 2} {
+			fr := newBenchmarkReceiver(format, outputChannels, nil)
+			data := make([]byte, benchmarkFrames*2*format.BytesPerSample())
+
+			allocs := testing.AllocsPerRun(100, func() {
+				fr.OnReceive(data, benchmarkFrames)
+			})
+
+			if allocs != 0 {
+				t.Errorf("%s, %d output channels: %.1f allocs per call, want 0", format, outputChannels, allocs)
+			}
+		}
+	}
+}
+
+func BenchmarkFrameReceiverOnReceive(b *testing.B) {
+	for _, format := range benchmarkFormats {
+		for _, outputChannels := range []int{1, 2} {
+			for _, record := range []bool{false, true} {
+				name := fmt.Sprintf("%s/channels=%d/record=%t", format, outputChannels, record)
+
+				b.Run(name, func(b *testing.B) {
+					var recorder *Recorder
+					if record {
+						dir, err := ioutil.TempDir("", "luxaudio")
+						if err != nil {
+							b.Fatal(err)
+						}
+						defer func() { _ = os.RemoveAll(dir) }()
+
+						recorder, err = NewRecorder(filepath.Join(dir, "bench.wav"), format, 2, 48000, 0, 0, 0)
+						if err != nil {
+							b.Fatal(err)
+						}
+						defer recorder.Close()
+					}
+
+					fr := newBenchmarkReceiver(format, outputChannels, recorder)
+					data := make([]byte, benchmarkFrames*2*format.BytesPerSample())
+
+					// let the reused buffers grow to their size
+					fr.OnReceive(data, benchmarkFrames)
+
+					b.ReportAllocs()
+					b.SetBytes(int64(len(data)))
+					b.ResetTimer()
+
+					for i := 0; i < b.N; i++ {
+						fr.OnReceive(data, benchmarkFrames)
+					}
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultGeneratorSampleRate = 44100
+	defaultGeneratorChannels   = 1
+
+	pinkImpulseLength = 1 << 16
+)
+
+type GeneratorSource struct {
+	next func() float64
+
+	channels   int
+	sampleRate int
+
+	periodFrames int
+
+	stop   chan struct{}
+	errors chan error
+}
+
+// NewGeneratorSource creates a source of synthetic calibration signals. The sweep is logarithmic from lowFreq
+// to highFreq and repeats every sweepDuration. The level is in dBFS, noise having the RMS of a sine at that level,
+// less the peaks that are clipped close to 0 dBFS.
+func NewGeneratorSource(
+	signal string,
+	level float64,
+	freq float64,
+	lowFreq float64,
+	highFreq float64,
+	sweepDuration time.Duration,
+	clickRate float64,
+	channels int,
+	sampleRate int,
+) (*GeneratorSource, error) {
+	if channels == 0 {
+		channels = defaultGeneratorChannels
+	}
+	if sampleRate == 0 {
+		sampleRate = defaultGeneratorSampleRate
+	}
+
+	amplitude := math.Pow(10, level/20)
+	sr := float64(sampleRate)
+
+	var next func() float64
+	switch signal {
+	case "sine":
+		next = newSine(amplitude, freq, sr)
+
+	case "sweep":
+		if sweepDuration <= 0 || lowFreq <= 0 || highFreq <= lowFreq {
+			return nil, fmt.Errorf("invalid sweep from %.0f Hz to %.0f Hz over %v", lowFreq, highFreq, sweepDuration)
+		}
+		next = newSweep(amplitude, lowFreq, highFreq, sweepDuration.Seconds(), sr)
+
+	case "white":
+		next = newWhiteNoise(amplitude)
+
+	case "pink":
+		next = newPinkNoise(amplitude)
+
+	case "click":
+		if clickRate <= 0 {
+			return nil, fmt.Errorf("invalid click rate: %f", clickRate)
+		}
+		next = newClickTrain(amplitude, clickRate, sr)
+
+	default:
+		return nil, fmt.Errorf("unsupported generator: %s", signal)
+	}
+
+	return &GeneratorSource{
+		next: next,
+
+		channels:   channels,
+		sampleRate: sampleRate,
+
+		periodFrames: getPeriodFrames(sampleRate),
+
+		stop:   make(chan struct{}),
+		errors: make(chan error, 1),
+	}, nil
+}
+
+func (s *GeneratorSource) Start(onData DataCallback) error {
+	go s.run(onData)
+	return nil
+}
+
+func (s *GeneratorSource) Stop() error {
+	close(s.stop)
+	return nil
+}
+
+func (s *GeneratorSource) Format() Format {
+	return FormatF32
+}
+
+func (s *GeneratorSource) Channels() int {
+	return s.channels
+}
+
+func (s *GeneratorSource) SampleRate() int {
+	return s.sampleRate
+}
+
+func (s *GeneratorSource) Errors() <-chan error {
+	return s.errors
+}
+
+func (s *GeneratorSource) run(onData DataCallback) {
+	frameSize := FormatF32.BytesPerSample() * s.channels
+	buf := make([]byte, s.periodFrames*frameSize)
+
+	start := time.Now()
+	framesGenerated := int64(0)
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+
+		for i := 0; i < s.periodFrames; i++ {
+			bits := math.Float32bits(float32(s.next()))
+			for j := 0; j < s.channels; j++ {
+				binary.LittleEndian.PutUint32(buf[i*frameSize+j*4:], bits)
+			}
+		}
+
+		onData(buf, uint32(s.periodFrames))
+		framesGenerated += int64(s.periodFrames)
+
+		due := start.Add(time.Duration(framesGenerated) * time.Second / time.Duration(s.sampleRate))
+		time.Sleep(time.Until(due))
+	}
+}
+
+func newSine(amplitude float64, freq float64, sampleRate float64) func() float64 {
+	phase := 0.0
+	step := 2 * math.Pi * freq / sampleRate
+
+	return func() float64 {
+		x := amplitude * math.Sin(phase)
+		phase = math.Mod(phase+step, 2*math.Pi)
+		return x
+	}
+}
+
+func newSweep(amplitude float64, lowFreq float64, highFreq float64, duration float64, sampleRate float64) func() float64 {
+	phase := 0.0
+	n := 0
+	total := int(duration * sampleRate)
+	ratio := highFreq / lowFreq
+
+	return func() float64 {
+		// the instantaneous frequency grows exponentially, so every octave takes the same time
+		freq := lowFreq * math.Pow(ratio, float64(n)/float64(total))
+
+		x := amplitude * math.Sin(phase)
+		phase = math.Mod(phase+2*math.Pi*freq/sampleRate, 2*math.Pi)
+		n = (n + 1) % total
+
+		return x
+	}
+}
+
+func newWhiteNoise(amplitude float64) func() float64 {
+	rms := amplitude / math.Sqrt2
+
+	return func() float64 {
+		return clip(rand.NormFloat64() * rms)
+	}
+}
+
+func newPinkNoise(amplitude float64) func() float64 {
+	rms := amplitude / math.Sqrt2
+	filter := newPinkFilter()
+
+	// the filter attenuates white noise by the root of the energy of its impulse response,
+	// which decays below 1e-8 within pinkImpulseLength samples
+	energy := 0.0
+	impulse := newPinkFilter()
+	for n := 0; n < pinkImpulseLength; n++ {
+		x := 0.0
+		if n == 0 {
+			x = 1
+		}
+
+		y := impulse(x)
+		energy += y * y
+	}
+	gain := 1 / math.Sqrt(energy)
+
+	return func() float64 {
+		// the white noise isn't clipped before filtering, so that only the peaks of the result are
+		return clip(filter(rand.NormFloat64()*rms) * gain)
+	}
+}
+
+// newPinkFilter is Paul Kellett's refined pink noise filter, which turns white noise into pink noise
+func newPinkFilter() func(w float64) float64 {
+	var b0, b1, b2, b3, b4, b5, b6 float64
+
+	return func(w float64) float64 {
+		b0 = 0.99886*b0 + w*0.0555179
+		b1 = 0.99332*b1 + w*0.0750759
+		b2 = 0.96900*b2 + w*0.1538520
+		b3 = 0.86650*b3 + w*0.3104856
+		b4 = 0.55000*b4 + w*0.5329522
+		b5 = -0.7616*b5 - w*0.0168980
+		pink := b0 + b1 + b2 + b3 + b4 + b5 + b6 + w*0.5362
+		b6 = w * 0.115926
+
+		return pink
+	}
+}
+
+func newClickTrain(amplitude float64, rate float64, sampleRate float64) func() float64 {
+	interval := sampleRate / rate
+	n := 0.0
+
+	return func() float64 {
+		x := 0.0
+		if n < 1 {
+			x = amplitude
+		}
+
+		n++
+		if n >= interval {
+			n -= interval
+		}
+
+		return x
+	}
+}
+
+func clip(x float64) float64 {
+	return math.Max(-1, math.Min(1, x))
+}
@@ -0,0 +1,308 @@
+package audio
+
+import (
+	"fmt"
+	"github.com/gen2brain/malgo"
+	"log"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	minReconnectDelay = 1 * time.Second
+	maxReconnectDelay = 30 * time.Second
+)
+
+type MalgoSource struct {
+	backend    malgo.Backend
+	deviceType malgo.DeviceType
+	deviceId   string
+	deviceName string
+
+	format     malgo.FormatType
+	channels   uint32
+	sampleRate uint32
+
+	mutex   sync.Mutex
+	context *malgo.AllocatedContext
+	device  *malgo.Device
+
+	// accessed atomically, as the stop callback may run while the mutex is held
+	stopping     int32
+	reconnecting int32
+
+	onData DataCallback
+	errors chan error
+}
+
+func NewMalgoSource(
+	backend string,
+	device string,
+	deviceId string,
+	deviceName string,
+	format Format,
+	channels int,
+	sampleRate int,
+) (*MalgoSource, error) {
+	malgoBackend, err := getBackend(backend)
+	if err != nil {
+		return nil, err
+	}
+
+	malgoDevice, err := getDevice(device)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &MalgoSource{
+		backend:    malgoBackend,
+		deviceType: malgoDevice,
+		deviceId:   deviceId,
+		deviceName: deviceName,
+
+		format:     toMalgoFormat(format),
+		channels:   uint32(channels),
+		sampleRate: uint32(sampleRate),
+
+		errors: make(chan error, 1),
+	}
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	// reopening after a device loss must deliver exactly what the pipeline was built for
+	s.format = s.device.CaptureFormat()
+	s.channels = s.device.CaptureChannels()
+	s.sampleRate = s.device.SampleRate()
+
+	return s, nil
+}
+
+func (s *MalgoSource) Start(onData DataCallback) error {
+	s.onData = onData
+	return s.device.Start()
+}
+
+func (s *MalgoSource) Stop() error {
+	atomic.StoreInt32(&s.stopping, 1)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.close()
+
+	return nil
+}
+
+func (s *MalgoSource) open() error {
+	context, err := initContext(s.backend)
+	if err != nil {
+		return err
+	}
+
+	// loopback captures what a playback device is playing
+	kind := malgo.Capture
+	if s.deviceType == malgo.Loopback {
+		kind = malgo.Playback
+	}
+
+	id, err := findDevice(context, kind, s.deviceId, s.deviceName)
+	if err != nil {
+		freeContext(context)
+		return err
+	}
+
+	captureConfig := getCaptureConfig(s.deviceType, id, s.format, s.channels, s.sampleRate)
+
+	device, err := malgo.InitDevice(context.Context, captureConfig, malgo.DeviceCallbacks{
+		Data: func(_, data []byte, count uint32) { s.onData(data, count) },
+		Stop: s.onStop,
+	})
+	if err != nil {
+		freeContext(context)
+		return err
+	}
+
+	s.context = context
+	s.device = device
+
+	return nil
+}
+
+func (s *MalgoSource) close() {
+	if s.device != nil {
+		s.device.Uninit()
+		s.device = nil
+	}
+
+	if s.context != nil {
+		freeContext(s.context)
+		s.context = nil
+	}
+}
+
+func (s *MalgoSource) onStop() {
+	if atomic.LoadInt32(&s.stopping) == 1 || !atomic.CompareAndSwapInt32(&s.reconnecting, 0, 1) {
+		return
+	}
+
+	log.Println("Audio device stopped, reconnecting...")
+
+	// the device can't be uninitialized from within its own callback
+	go s.reconnect()
+}
+
+func (s *MalgoSource) reconnect() {
+	defer atomic.StoreInt32(&s.reconnecting, 0)
+	delay := minReconnectDelay
+
+	for {
+		if atomic.LoadInt32(&s.stopping) == 1 {
+			return
+		}
+
+		s.mutex.Lock()
+		s.close()
+		err := s.open()
+		if err == nil {
+			err = s.device.Start()
+		}
+
+		if err == nil {
+			s.mutex.Unlock()
+			log.Println("Audio device reconnected")
+			return
+		}
+		s.mutex.Unlock()
+
+		log.Printf("Could not reconnect audio device, retrying in %v: %v\n", delay, err)
+		time.Sleep(delay)
+
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+func (s *MalgoSource) Format() Format {
+	return fromMalgoFormat(s.format)
+}
+
+func (s *MalgoSource) Channels() int {
+	return int(s.channels)
+}
+
+func (s *MalgoSource) SampleRate() int {
+	return int(s.sampleRate)
+}
+
+func (s *MalgoSource) Errors() <-chan error {
+	return s.errors
+}
+
+func freeContext(context *malgo.AllocatedContext) {
+	_ = context.Uninit()
+	context.Free()
+}
+
+func initContext(backend malgo.Backend) (*malgo.AllocatedContext, error) {
+	ctxConfig := malgo.ContextConfig{}
+	ctxConfig.ThreadPriority = malgo.ThreadPriorityRealtime
+
+	return malgo.InitContext([]malgo.Backend{backend}, ctxConfig, func(message string) {
+		log.Printf("LOG <%v>\n", message)
+	})
+}
+
+func getCaptureConfig(device malgo.DeviceType, id *malgo.DeviceID, format malgo.FormatType, channels uint32, sampleRate uint32) malgo.DeviceConfig {
+	captureConfig := malgo.DefaultDeviceConfig(device)
+	captureConfig.PerformanceProfile = malgo.LowLatency
+	captureConfig.Capture.DeviceID = id
+	captureConfig.Capture.Format = format
+	captureConfig.SampleRate = sampleRate
+	captureConfig.Capture.Channels = channels
+
+	return captureConfig
+}
+
+func getBackend(backend string) (malgo.Backend, error) {
+	switch backend {
+	case "auto":
+		switch os := runtime.GOOS; os {
+		case "linux":
+			return malgo.BackendAlsa, nil
+
+		case "windows":
+			return malgo.BackendWasapi, nil
+
+		default:
+			return malgo.BackendNull, fmt.Errorf("unsupported operating system: %s", os)
+		}
+
+	case "alsa":
+		return malgo.BackendAlsa, nil
+
+	case "pulse":
+		return malgo.BackendPulseaudio, nil
+
+	case "jack":
+		return malgo.BackendJack, nil
+
+	case "wasapi":
+		return malgo.BackendWasapi, nil
+
+	default:
+		return malgo.BackendNull, fmt.Errorf("unsupported backend: %s", backend)
+	}
+}
+
+func getDevice(device string) (malgo.DeviceType, error) {
+	switch device {
+	case "loopback":
+		return malgo.Loopback, nil
+
+	case "capture":
+		return malgo.Capture, nil
+
+	default:
+		return 0, fmt.Errorf("unsupported device: %s", device)
+	}
+}
+
+func toMalgoFormat(format Format) malgo.FormatType {
+	switch format {
+	case FormatU8:
+		return malgo.FormatU8
+	case FormatS16:
+		return malgo.FormatS16
+	case FormatS24:
+		return malgo.FormatS24
+	case FormatS32:
+		return malgo.FormatS32
+	case FormatF32:
+		return malgo.FormatF32
+	default:
+		return malgo.FormatUnknown
+	}
+}
+
+func fromMalgoFormat(format malgo.FormatType) Format {
+	switch format {
+	case malgo.FormatU8:
+		return FormatU8
+	case malgo.FormatS16:
+		return FormatS16
+	case malgo.FormatS24:
+		return FormatS24
+	case malgo.FormatS32:
+		return FormatS32
+	case malgo.FormatF32:
+		return FormatF32
+	default:
+		return FormatUnknown
+	}
+}
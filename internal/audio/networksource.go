@@ -0,0 +1,191 @@
+package audio
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	ProtocolRtp = "rtp"
+	ProtocolUdp = "udp"
+
+	// PulseAudio's RTP sink sends 16-bit stereo at 44.1 kHz by default
+	defaultRtpChannels   = 2
+	defaultRtpSampleRate = 44100
+)
+
+type NetworkSource struct {
+	conn     *net.UDPConn
+	protocol string
+
+	format     Format
+	channels   int
+	sampleRate int
+
+	jitter *jitterBuffer
+
+	// only the first packet of an unexpected payload type is logged
+	wrongPayloadType bool
+
+	mutex   sync.Mutex
+	stopped bool
+
+	errors chan error
+}
+
+// NewNetworkSource receives audio over UDP, either as RTP with L16/L24 payloads or as raw
+// little-endian PCM datagrams. RTP packets go through a jitter buffer of jitterPackets packets.
+func NewNetworkSource(
+	address string,
+	protocol string,
+	format Format,
+	channels int,
+	sampleRate int,
+	jitterPackets int,
+) (*NetworkSource, error) {
+	switch protocol {
+	case ProtocolRtp:
+		if format != FormatS16 && format != FormatS24 {
+			return nil, fmt.Errorf("RTP only supports L16 and L24 payloads, not %s", format)
+		}
+
+		if channels == 0 {
+			channels = defaultRtpChannels
+		}
+		if sampleRate == 0 {
+			sampleRate = defaultRtpSampleRate
+		}
+
+	case ProtocolUdp:
+		if channels == 0 || sampleRate == 0 {
+			return nil, fmt.Errorf("sample rate and channels must be specified for raw UDP input")
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported protocol: %s", protocol)
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NetworkSource{
+		conn:     conn,
+		protocol: protocol,
+
+		format:     format,
+		channels:   channels,
+		sampleRate: sampleRate,
+
+		jitter: newJitterBuffer(jitterPackets, format),
+
+		errors: make(chan error, 1),
+	}, nil
+}
+
+func (s *NetworkSource) Start(onData DataCallback) error {
+	go s.listen(onData)
+	return nil
+}
+
+func (s *NetworkSource) Stop() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.stopped = true
+	return s.conn.Close()
+}
+
+func (s *NetworkSource) Format() Format {
+	return s.format
+}
+
+func (s *NetworkSource) Channels() int {
+	return s.channels
+}
+
+func (s *NetworkSource) SampleRate() int {
+	return s.sampleRate
+}
+
+func (s *NetworkSource) Errors() <-chan error {
+	return s.errors
+}
+
+func (s *NetworkSource) listen(onData DataCallback) {
+	buf := make([]byte, 65536)
+
+	for {
+		if s.protocol == ProtocolRtp {
+			_ = s.conn.SetReadDeadline(time.Now().Add(rtpFlushTimeout))
+		}
+
+		n, _, err := s.conn.ReadFromUDP(buf)
+		if err, ok := err.(net.Error); ok && err.Timeout() {
+			// the stream stopped, so the packets held back won't be pushed out by later ones
+			for _, p := range s.jitter.Flush() {
+				s.deliver(p, onData)
+			}
+			continue
+		}
+
+		if err != nil {
+			if !s.isStopped() {
+				s.errors <- err
+			}
+			return
+		}
+
+		if s.protocol == ProtocolUdp {
+			s.deliver(buf[:n], onData)
+			continue
+		}
+
+		packet, err := parseRtpPacket(buf[:n])
+		if err != nil {
+			log.Printf("Dropping packet: %v\n", err)
+			continue
+		}
+
+		if err := checkPayloadType(packet.payloadType, s.format, s.channels, s.sampleRate); err != nil {
+			if !s.wrongPayloadType {
+				log.Printf("WARN: Dropping packets: %v\n", err)
+				s.wrongPayloadType = true
+			}
+			continue
+		}
+
+		// the jitter buffer holds on to payloads, so they can't share the receive buffer
+		payload := append([]byte{}, packet.payload...)
+		swapEndianness(s.format, payload)
+
+		for _, p := range s.jitter.Push(packet.sequence, payload) {
+			s.deliver(p, onData)
+		}
+	}
+}
+
+func (s *NetworkSource) deliver(data []byte, onData DataCallback) {
+	frameSize := s.format.BytesPerSample() * s.channels
+	frameCount := len(data) / frameSize
+
+	if frameCount > 0 {
+		onData(data[:frameCount*frameSize], uint32(frameCount))
+	}
+}
+
+func (s *NetworkSource) isStopped() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.stopped
+}
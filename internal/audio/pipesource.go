@@ -0,0 +1,172 @@
+package audio
+
+import (
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+const StdinPath = "-"
+
+type PipeSource struct {
+	path string
+
+	format     Format
+	channels   int
+	sampleRate int
+
+	periodFrames int
+
+	mutex   sync.Mutex
+	reader  io.ReadCloser
+	stopped bool
+
+	errors chan error
+}
+
+func NewPipeSource(path string, format Format, channels int, sampleRate int) *PipeSource {
+	return &PipeSource{
+		path: path,
+
+		format:     format,
+		channels:   channels,
+		sampleRate: sampleRate,
+
+		periodFrames: getPeriodFrames(sampleRate),
+
+		errors: make(chan error, 1),
+	}
+}
+
+func IsPipe(path string) bool {
+	if path == StdinPath {
+		return true
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeNamedPipe != 0
+}
+
+func (s *PipeSource) Start(onData DataCallback) error {
+	go func() {
+		err := s.run(onData)
+		if err == nil {
+			err = io.EOF
+		}
+		s.errors <- err
+	}()
+
+	return nil
+}
+
+func (s *PipeSource) Stop() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.stopped = true
+	if s.reader != nil {
+		return s.reader.Close()
+	}
+
+	return nil
+}
+
+func (s *PipeSource) Format() Format {
+	return s.format
+}
+
+func (s *PipeSource) Channels() int {
+	return s.channels
+}
+
+func (s *PipeSource) SampleRate() int {
+	return s.sampleRate
+}
+
+func (s *PipeSource) Errors() <-chan error {
+	return s.errors
+}
+
+// run reads raw interleaved PCM until stdin is closed. A FIFO is reopened whenever
+// its writer goes away, so run only returns for a FIFO if it's stopped or an error occurs.
+func (s *PipeSource) run(onData DataCallback) error {
+	for {
+		r, err := s.open()
+		if err != nil || r == nil {
+			return err
+		}
+
+		err = s.readAll(r, onData)
+		_ = r.Close()
+
+		if s.isStopped() || s.path == StdinPath {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		log.Printf("Writer of %s disconnected, waiting for a new one...\n", s.path)
+	}
+}
+
+func (s *PipeSource) open() (io.ReadCloser, error) {
+	var r io.ReadCloser = os.Stdin
+	if s.path != StdinPath {
+		// blocks until a writer opens the FIFO
+		f, err := os.Open(s.path)
+		if err != nil {
+			return nil, err
+		}
+		r = f
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.stopped {
+		_ = r.Close()
+		return nil, nil
+	}
+
+	s.reader = r
+	return r, nil
+}
+
+func (s *PipeSource) isStopped() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.stopped
+}
+
+func (s *PipeSource) readAll(r io.Reader, onData DataCallback) error {
+	frameSize := s.format.BytesPerSample() * s.channels
+	buf := make([]byte, s.periodFrames*frameSize)
+	pending := 0
+
+	for {
+		n, err := r.Read(buf[pending:])
+		pending += n
+
+		// only whole frames are delivered, the remainder waits for the next read
+		whole := pending - pending%frameSize
+		if whole > 0 {
+			onData(buf[:whole], uint32(whole/frameSize))
+			pending = copy(buf, buf[whole:pending])
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
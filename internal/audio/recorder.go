@@ -0,0 +1,258 @@
+package audio
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	recorderQueueLength  = 256
+	recorderSyncInterval = 1 * time.Second
+)
+
+// Recorder writes audio to WAV files in the background, so that the audio callback never waits for the disk.
+// The chunks are copied into buffers that are reused once written, so recording doesn't allocate in the callback.
+// When a file reaches maxBytes or maxDuration, a new one is started and only the newest keep files are kept.
+// A new file is always started before the 4 GiB that a WAV file can hold at most.
+type Recorder struct {
+	// accessed atomically, kept first for 64-bit alignment on 32-bit platforms
+	dropped int64
+
+	path string
+
+	format     Format
+	channels   int
+	sampleRate int
+
+	maxBytes    int64
+	maxDuration time.Duration
+	keep        int
+
+	writer *WavWriter
+	files  []string
+	index  int
+
+	mutex  sync.RWMutex
+	closed bool
+	chunks chan []byte
+	free   chan []byte
+	done   chan struct{}
+}
+
+func NewRecorder(
+	path string,
+	format Format,
+	channels int,
+	sampleRate int,
+	maxBytes int64,
+	maxDuration time.Duration,
+	keep int,
+) (*Recorder, error) {
+	r := &Recorder{
+		path: path,
+
+		format:     format,
+		channels:   channels,
+		sampleRate: sampleRate,
+
+		maxBytes:    maxBytes,
+		maxDuration: maxDuration,
+		keep:        keep,
+
+		files: make([]string, 0),
+
+		chunks: make(chan []byte, recorderQueueLength),
+		free:   make(chan []byte, recorderQueueLength),
+		done:   make(chan struct{}),
+	}
+
+	// the buffers grow to the size of the chunks on first use
+	for i := 0; i < recorderQueueLength; i++ {
+		r.free <- nil
+	}
+
+	if err := r.rotate(); err != nil {
+		return nil, err
+	}
+
+	go r.run()
+
+	return r, nil
+}
+
+// Write queues a copy of data to be recorded. Data is dropped if the disk can't keep up.
+func (r *Recorder) Write(data []byte) {
+	chunk, ok := r.acquire(len(data))
+	if !ok {
+		return
+	}
+
+	copy(chunk, data)
+	r.enqueue(chunk)
+}
+
+// WriteFloats records samples in [-1, 1], which is only valid for a float recorder
+func (r *Recorder) WriteFloats(samples []float64) {
+	sampleSize := r.format.BytesPerSample()
+
+	chunk, ok := r.acquire(len(samples) * sampleSize)
+	if !ok {
+		return
+	}
+
+	for i, x := range samples {
+		encodeSample(r.format, chunk[i*sampleSize:], x)
+	}
+
+	r.enqueue(chunk)
+}
+
+// Close writes out everything that was queued and finalizes the current file
+func (r *Recorder) Close() {
+	r.mutex.Lock()
+	r.closed = true
+	close(r.chunks)
+	r.mutex.Unlock()
+
+	<-r.done
+}
+
+// acquire takes a buffer of size bytes that has been written out already. If there's none,
+// all of them are still queued because the disk can't keep up, and the chunk is dropped.
+func (r *Recorder) acquire(size int) ([]byte, bool) {
+	select {
+	case chunk := <-r.free:
+		if cap(chunk) < size {
+			chunk = make([]byte, size)
+		}
+		return chunk[:size], true
+
+	default:
+		atomic.AddInt64(&r.dropped, 1)
+		return nil, false
+	}
+}
+
+func (r *Recorder) release(chunk []byte) {
+	select {
+	case r.free <- chunk:
+	default:
+	}
+}
+
+func (r *Recorder) enqueue(chunk []byte) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if r.closed {
+		return
+	}
+
+	// there are only as many buffers as the queue holds, so this never blocks
+	r.chunks <- chunk
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(recorderSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case chunk, ok := <-r.chunks:
+			if !ok {
+				r.closeWriter()
+				return
+			}
+
+			err := r.write(chunk)
+			r.release(chunk)
+
+			if err != nil {
+				log.Printf("WARN: Recording stopped: %v\n", err)
+				r.closeWriter()
+				r.drain()
+				return
+			}
+
+		case <-ticker.C:
+			if dropped := atomic.SwapInt64(&r.dropped, 0); dropped > 0 {
+				log.Printf("WARN: Recorder dropped %d chunks\n", dropped)
+			}
+
+			if err := r.writer.WriteHeader(); err != nil {
+				log.Printf("WARN: Could not update recording header: %v\n", err)
+			}
+		}
+	}
+}
+
+func (r *Recorder) write(chunk []byte) error {
+	bytesPerSecond := int64(r.sampleRate * r.channels * r.format.BytesPerSample())
+	size := r.writer.DataSize + int64(len(chunk))
+	fileSize := wavHeaderSize + size + size%2
+
+	exceedsSize := fileSize > wavMaxFileSize || (r.maxBytes > 0 && fileSize > r.maxBytes)
+	exceedsDuration := r.maxDuration > 0 && time.Duration(size*int64(time.Second)/bytesPerSecond) > r.maxDuration
+
+	if r.writer.DataSize > 0 && (exceedsSize || exceedsDuration) {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+
+	return r.writer.Write(chunk)
+}
+
+func (r *Recorder) rotate() error {
+	r.closeWriter()
+
+	path := r.path
+	if r.index > 0 {
+		ext := filepath.Ext(r.path)
+		path = fmt.Sprintf("%s.%d%s", strings.TrimSuffix(r.path, ext), r.index, ext)
+	}
+	r.index++
+
+	writer, err := NewWavWriter(path, r.format, r.channels, r.sampleRate)
+	if err != nil {
+		return err
+	}
+
+	r.writer = writer
+	r.files = append(r.files, path)
+
+	if r.keep > 0 && len(r.files) > r.keep {
+		if err := os.Remove(r.files[0]); err != nil {
+			log.Printf("WARN: Could not remove old recording: %v\n", err)
+		}
+		r.files = r.files[1:]
+	}
+
+	log.Printf("Recording to %s\n", path)
+	return nil
+}
+
+func (r *Recorder) closeWriter() {
+	if r.writer == nil {
+		return
+	}
+
+	if err := r.writer.Close(); err != nil {
+		log.Printf("WARN: Could not finalize recording: %v\n", err)
+	}
+	r.writer = nil
+}
+
+func (r *Recorder) drain() {
+	for chunk := range r.chunks {
+		r.release(chunk)
+	}
+}
@@ -0,0 +1,202 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	rtpVersion       = 2
+	rtpHeaderSize    = 12
+	rtpMaxConcealed  = 3
+	rtpResyncPackets = 100
+
+	// the jitter buffer is flushed when no packet arrives for this long
+	rtpFlushTimeout = 200 * time.Millisecond
+
+	// static payload types of RFC 3551, the others used for audio are dynamic
+	rtpPayloadL16Stereo = 10
+	rtpPayloadL16Mono   = 11
+	rtpMinDynamicType   = 96
+)
+
+type rtpPacket struct {
+	sequence    uint16
+	payloadType uint8
+	payload     []byte
+}
+
+func parseRtpPacket(data []byte) (*rtpPacket, error) {
+	if len(data) < rtpHeaderSize {
+		return nil, fmt.Errorf("RTP packet is too short: %d", len(data))
+	}
+
+	if data[0]>>6 != rtpVersion {
+		return nil, fmt.Errorf("unsupported RTP version: %d", data[0]>>6)
+	}
+
+	hasPadding := data[0]&0x20 != 0
+	hasExtension := data[0]&0x10 != 0
+	csrcCount := int(data[0] & 0x0F)
+
+	offset := rtpHeaderSize + csrcCount*4
+	if hasExtension {
+		if len(data) < offset+4 {
+			return nil, errors.New("RTP header extension is truncated")
+		}
+		offset += 4 + int(binary.BigEndian.Uint16(data[offset+2:offset+4]))*4
+	}
+
+	end := len(data)
+	if hasPadding && end > 0 {
+		end -= int(data[end-1])
+	}
+
+	if offset > end {
+		return nil, errors.New("RTP packet has no payload")
+	}
+
+	return &rtpPacket{
+		sequence:    binary.BigEndian.Uint16(data[2:4]),
+		payloadType: data[1] & 0x7F,
+		payload:     data[offset:end],
+	}, nil
+}
+
+// checkPayloadType tells whether packets of a payload type can be decoded as the given audio.
+// Dynamic payload types are negotiated out of band, so they're trusted to match.
+func checkPayloadType(payloadType uint8, format Format, channels int, sampleRate int) error {
+	switch {
+	case payloadType >= rtpMinDynamicType:
+		return nil
+	case payloadType == rtpPayloadL16Stereo && format == FormatS16 && channels == 2 && sampleRate == 44100:
+		return nil
+	case payloadType == rtpPayloadL16Mono && format == FormatS16 && channels == 1 && sampleRate == 44100:
+		return nil
+	default:
+		return fmt.Errorf("RTP payload type %d doesn't carry %s with %d channels at %d Hz", payloadType, format, channels, sampleRate)
+	}
+}
+
+// jitterBuffer reorders RTP payloads by sequence number. It holds back up to depth packets
+// and conceals lost packets by repeating the last payload with decreasing level.
+type jitterBuffer struct {
+	depth   int
+	format  Format
+	packets map[uint16][]byte
+
+	started   bool
+	next      uint16
+	last      []byte
+	concealed int
+}
+
+func newJitterBuffer(depth int, format Format) *jitterBuffer {
+	return &jitterBuffer{
+		depth:   depth,
+		format:  format,
+		packets: make(map[uint16][]byte),
+	}
+}
+
+// Push adds a payload and returns the payloads that are due to be played, in order
+func (jb *jitterBuffer) Push(sequence uint16, payload []byte) [][]byte {
+	due := make([][]byte, 0)
+
+	distance := int16(sequence - jb.next)
+	if jb.started && (distance > rtpResyncPackets || distance < -rtpResyncPackets) {
+		// the sender was most likely restarted, with a new random initial sequence number,
+		// so play what's left of the old stream and start over
+		due = jb.Flush()
+	} else if jb.started && distance < 0 {
+		// too late, it was already played or concealed
+		return nil
+	}
+
+	if !jb.started {
+		jb.started = true
+		jb.next = sequence
+	}
+
+	jb.packets[sequence] = payload
+
+	for len(jb.packets) > jb.depth {
+		due = append(due, jb.pop())
+	}
+
+	return due
+}
+
+// Flush returns the payloads that are still held back, in order, e.g. once the stream stopped.
+// The next payload starts the buffer over.
+func (jb *jitterBuffer) Flush() [][]byte {
+	due := make([][]byte, 0)
+	for len(jb.packets) > 0 {
+		due = append(due, jb.pop())
+	}
+
+	jb.started = false
+	jb.last = nil
+	jb.concealed = 0
+
+	return due
+}
+
+func (jb *jitterBuffer) pop() []byte {
+	payload, ok := jb.packets[jb.next]
+	if ok {
+		delete(jb.packets, jb.next)
+		jb.last = payload
+		jb.concealed = 0
+	} else {
+		payload = jb.conceal()
+	}
+
+	jb.next++
+	return payload
+}
+
+func (jb *jitterBuffer) conceal() []byte {
+	if jb.last == nil {
+		return nil
+	}
+
+	jb.concealed++
+	concealed := make([]byte, len(jb.last))
+	if jb.concealed > rtpMaxConcealed {
+		// give up and play silence
+		if jb.format == FormatU8 {
+			for i := range concealed {
+				concealed[i] = 0x80
+			}
+		}
+		return concealed
+	}
+
+	// repeat the last payload, halving its level each time
+	copy(concealed, jb.last)
+	attenuate(jb.format, concealed, 1/float64(int(1)<<uint(jb.concealed)))
+
+	return concealed
+}
+
+func attenuate(format Format, data []byte, gain float64) {
+	sampleSize := format.BytesPerSample()
+
+	for i := 0; i+sampleSize <= len(data); i += sampleSize {
+		encodeSample(format, data[i:i+sampleSize], decodeSample(format, data[i:i+sampleSize])*gain)
+	}
+}
+
+// swapEndianness converts big-endian samples, as used by RTP, to little-endian in place
+func swapEndianness(format Format, data []byte) {
+	sampleSize := format.BytesPerSample()
+
+	for i := 0; i+sampleSize <= len(data); i += sampleSize {
+		for a, b := i, i+sampleSize-1; a < b; a, b = a+1, b-1 {
+			data[a], data[b] = data[b], data[a]
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package audio
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// rtpFlush stands for a flush in the sequences pushed to a jitter buffer
+const rtpFlush = -1
+
+// rtpMarker is the sample that a test payload carries, so that the order it's played in can be checked.
+// It's a multiple of 8, so that concealment halves it exactly.
+func rtpMarker(sequence uint16) int {
+	return int(sequence%4096) * 8
+}
+
+func rtpPayload(sequence uint16) []byte {
+	payload := make([]byte, 2)
+	binary.LittleEndian.PutUint16(payload, uint16(rtpMarker(sequence)))
+	return payload
+}
+
+func rtpMarkers(payloads [][]byte) []int {
+	markers := make([]int, 0, len(payloads))
+	for _, payload := range payloads {
+		markers = append(markers, int(int16(binary.LittleEndian.Uint16(payload))))
+	}
+	return markers
+}
+
+func TestJitterBuffer(t *testing.T) {
+	m := rtpMarker
+
+	tests := []struct {
+		name   string
+		depth  int
+		pushed []int
+		want   []int
+	}{
+		{"in order", 2, []int{1, 2, 3, 4}, []int{m(1), m(2), m(3), m(4)}},
+		{"sequence wraparound", 2, []int{65533, 65534, 65535, 0, 1}, []int{m(65533), m(65534), m(65535), m(0), m(1)}},
+		{"reordered within depth", 2, []int{1, 3, 2, 5, 4, 6}, []int{m(1), m(2), m(3), m(4), m(5), m(6)}},
+		{"reordered across wraparound", 2, []int{65534, 0, 65535, 1}, []int{m(65534), m(65535), m(0), m(1)}},
+		{"late packet dropped", 1, []int{1, 2, 3, 1, 4}, []int{m(1), m(2), m(3), m(4)}},
+		{"duplicate packet", 2, []int{1, 2, 2, 3}, []int{m(1), m(2), m(3)}},
+		{"lost packet concealed", 2, []int{1, 2, 4, 5, 6}, []int{m(1), m(2), m(2) / 2, m(4), m(5), m(6)}},
+		{"backward jump resyncs", 2, []int{1000, 1001, 1002, 10, 11, 12}, []int{m(1000), m(1001), m(1002), m(10), m(11), m(12)}},
+		{"backward jump across wraparound resyncs", 2, []int{5, 6, 65000, 65001}, []int{m(5), m(6), m(65000), m(65001)}},
+		{"forward jump resyncs", 2, []int{1, 2, 3, 5000, 5001, 5002}, []int{m(1), m(2), m(3), m(5000), m(5001), m(5002)}},
+		{"flush starts over", 2, []int{100, 101, rtpFlush, 50, 51}, []int{m(100), m(101), m(50), m(51)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jb := newJitterBuffer(test.depth, FormatS16)
+
+			played := make([][]byte, 0)
+			for _, sequence := range test.pushed {
+				if sequence == rtpFlush {
+					played = append(played, jb.Flush()...)
+				} else {
+					played = append(played, jb.Push(uint16(sequence), rtpPayload(uint16(sequence)))...)
+				}
+			}
+			played = append(played, jb.Flush()...)
+
+			if got := rtpMarkers(played); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("played %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestJitterBufferConcealment(t *testing.T) {
+	// a packet, rtpMaxConcealed+1 lost ones and another packet
+	want := []float64{0.5, 0.25, 0.125, 0.0625, 0, 0.5}
+
+	for _, format := range []Format{FormatU8, FormatS16, FormatS24, FormatF32} {
+		t.Run(format.String(), func(t *testing.T) {
+			sampleSize := format.BytesPerSample()
+			payload := make([]byte, 2*sampleSize)
+			encodeSample(format, payload[:sampleSize], 0.5)
+			encodeSample(format, payload[sampleSize:], 0.5)
+
+			jb := newJitterBuffer(1, format)
+			played := jb.Push(1, payload)
+			for sequence := uint16(6); sequence <= 7; sequence++ {
+				played = append(played, jb.Push(sequence, append([]byte(nil), payload...))...)
+			}
+
+			if len(played) != len(want) {
+				t.Fatalf("played %d payloads, want %d", len(played), len(want))
+			}
+
+			for i, p := range played {
+				if len(p) != len(payload) {
+					t.Fatalf("payload %d has %d bytes, want %d", i, len(p), len(payload))
+				}
+
+				for j := 0; j < len(p); j += sampleSize {
+					if got := decodeSample(format, p[j:j+sampleSize]); math.Abs(got-want[i]) > 1.0/128 {
+						t.Errorf("payload %d sample %d = %v, want %v", i, j/sampleSize, got, want[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func rtpHeader(sequence uint16, payloadType uint8, flags byte, csrcCount int) []byte {
+	header := make([]byte, rtpHeaderSize+csrcCount*4)
+	header[0] = rtpVersion<<6 | flags | byte(csrcCount)
+	header[1] = 0x80 | payloadType // with the marker bit
+	binary.BigEndian.PutUint16(header[2:4], sequence)
+	return header
+}
+
+func TestParseRtpPacket(t *testing.T) {
+	payload := []byte{1, 2, 3, 4}
+	extension := []byte{0xBE, 0xDE, 0, 1, 9, 9, 9, 9}
+
+	tests := []struct {
+		name   string
+		packet []byte
+	}{
+		{"plain", append(rtpHeader(7, 96, 0, 0), payload...)},
+		{"with CSRCs", append(rtpHeader(7, 96, 0, 2), payload...)},
+		{"with extension", append(append(rtpHeader(7, 96, 0x10, 0), extension...), payload...)},
+		{"with padding", append(append(rtpHeader(7, 96, 0x20, 0), payload...), 0, 0, 3)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			packet, err := parseRtpPacket(test.packet)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if packet.sequence != 7 || packet.payloadType != 96 || !reflect.DeepEqual(packet.payload, payload) {
+				t.Errorf("got sequence %d, payload type %d, payload %v", packet.sequence, packet.payloadType, packet.payload)
+			}
+		})
+	}
+}
+
+func TestParseRtpPacketRejects(t *testing.T) {
+	wrongVersion := rtpHeader(7, 96, 0, 0)
+	wrongVersion[0] = 1 << 6
+
+	tests := []struct {
+		name   string
+		packet []byte
+	}{
+		{"too short", rtpHeader(7, 96, 0, 0)[:rtpHeaderSize-1]},
+		{"wrong version", wrongVersion},
+		{"truncated extension", append(rtpHeader(7, 96, 0x10, 0), 0xBE, 0xDE)},
+		{"extension beyond the end", append(rtpHeader(7, 96, 0x10, 0), 0xBE, 0xDE, 0, 4)},
+		{"CSRCs beyond the end", rtpHeader(7, 96, 0, 15)[:rtpHeaderSize+8]},
+		{"padding beyond the payload", append(rtpHeader(7, 96, 0x20, 0), 1, 6)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := parseRtpPacket(test.packet); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestCheckPayloadType(t *testing.T) {
+	tests := []struct {
+		payloadType uint8
+		format      Format
+		channels    int
+		sampleRate  int
+		ok          bool
+	}{
+		{rtpPayloadL16Stereo, FormatS16, 2, 44100, true},
+		{rtpPayloadL16Mono, FormatS16, 1, 44100, true},
+		{96, FormatS24, 2, 48000, true},
+		{127, FormatF32, 1, 96000, true},
+		{rtpPayloadL16Stereo, FormatS16, 1, 44100, false},
+		{rtpPayloadL16Stereo, FormatS16, 2, 48000, false},
+		{rtpPayloadL16Mono, FormatS24, 1, 44100, false},
+		{0, FormatU8, 1, 8000, false},
+	}
+
+	for _, test := range tests {
+		err := checkPayloadType(test.payloadType, test.format, test.channels, test.sampleRate)
+		if (err == nil) != test.ok {
+			t.Errorf("checkPayloadType(%d, %s, %d, %d) = %v, want ok = %v",
+				test.payloadType, test.format, test.channels, test.sampleRate, err, test.ok)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package audio
+
+import (
+	"errors"
+	"github.com/ivkos/luxaudio/internal/utils"
+	"log"
+)
+
+type DataCallback = func(data []byte, frameCount uint32)
+
+// Source delivers interleaved frames to the callback given to Start.
+// Finite sources report io.EOF on the error channel once they are exhausted.
+type Source interface {
+	Start(onData DataCallback) error
+	Stop() error
+
+	Format() Format
+	Channels() int
+	SampleRate() int
+
+	Errors() <-chan error
+}
+
+func NewSource(f utils.FlagsResult) (Source, error) {
+	source, err := newSource(f)
+	if err != nil {
+		return nil, err
+	}
+
+	// the flags are only requests, the source knows what it actually delivers
+	warnOnMismatch("sample rate", f.SampleRate, source.SampleRate())
+	warnOnMismatch("channels", f.Channels, source.Channels())
+
+	log.Printf("Input: %d Hz, %d channels, %s\n", source.SampleRate(), source.Channels(), source.Format())
+
+	return source, nil
+}
+
+func newSource(f utils.FlagsResult) (Source, error) {
+	formatName := f.Format
+	if formatName == "" {
+		formatName = FormatF32.String()
+		if f.Listen != "" && f.Protocol == ProtocolRtp {
+			formatName = FormatS16.String()
+		}
+	}
+
+	format, err := ParseFormat(formatName)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.Generator != "" {
+		return NewGeneratorSource(
+			f.Generator,
+			f.GeneratorLevel,
+			f.GeneratorFreq,
+			f.AudibleLow,
+			f.AudibleHigh,
+			f.GeneratorDuration,
+			f.GeneratorClickRate,
+			f.Channels,
+			f.SampleRate,
+		)
+	}
+
+	if f.Listen != "" {
+		return NewNetworkSource(f.Listen, f.Protocol, format, f.Channels, f.SampleRate, f.JitterPackets)
+	}
+
+	if f.Input == "" {
+		return NewMalgoSource(f.Backend, f.Device, f.DeviceId, f.DeviceName, format, f.Channels, f.SampleRate)
+	}
+
+	if IsPipe(f.Input) {
+		// raw PCM carries no header, so there's nothing to detect
+		if f.SampleRate == 0 || f.Channels == 0 {
+			return nil, errors.New("sample rate and channels must be specified for raw input")
+		}
+
+		return NewPipeSource(f.Input, format, f.Channels, f.SampleRate), nil
+	}
+
+	return NewWavFileSource(f.Input, f.Realtime, f.Loop)
+}
+
+// getPeriodFrames is how many frames a file or generated input delivers at a time, 10ms worth
+// like a low latency capture device would, but at least one frame at very low sample rates
+func getPeriodFrames(sampleRate int) int {
+	if sampleRate < 100 {
+		return 1
+	}
+
+	return sampleRate / 100
+}
+
+func warnOnMismatch(name string, requested int, actual int) {
+	if requested != 0 && requested != actual {
+		log.Printf("WARN: Requested %s %d, but the input provides %d\n", name, requested, actual)
+	}
+}
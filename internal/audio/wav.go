@@ -0,0 +1,255 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+const (
+	wavFormatPCM        = 0x0001
+	wavFormatIEEEFloat  = 0x0003
+	wavFormatExtensible = 0xFFFE
+
+	// the extensible fmt chunk is 40 bytes, a larger one is more likely a corrupt header than a future extension
+	wavMaxFmtChunkSize = 256
+)
+
+type WavHeader struct {
+	Format     Format
+	Channels   int
+	SampleRate int
+
+	DataOffset int64
+	DataSize   int64
+}
+
+func (h *WavHeader) FrameSize() int {
+	return h.Format.BytesPerSample() * h.Channels
+}
+
+func ReadWavHeader(r io.ReadSeeker) (*WavHeader, error) {
+	riff := make([]byte, 12)
+	if _, err := io.ReadFull(r, riff); err != nil {
+		return nil, fmt.Errorf("could not read RIFF header: %v", err)
+	}
+
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, errors.New("not a RIFF/WAVE file")
+	}
+
+	var header WavHeader
+	offset := int64(len(riff))
+	haveFmt := false
+
+	for {
+		chunkHeader := make([]byte, 8)
+		if _, err := io.ReadFull(r, chunkHeader); err != nil {
+			return nil, errors.New("no data chunk found")
+		}
+		offset += int64(len(chunkHeader))
+
+		chunkId := string(chunkHeader[0:4])
+		chunkSize := int64(binary.LittleEndian.Uint32(chunkHeader[4:8]))
+
+		switch chunkId {
+		case "fmt ":
+			if chunkSize > wavMaxFmtChunkSize {
+				return nil, fmt.Errorf("fmt chunk is too large: %d", chunkSize)
+			}
+
+			chunk := make([]byte, chunkSize)
+			if _, err := io.ReadFull(r, chunk); err != nil {
+				return nil, fmt.Errorf("could not read fmt chunk: %v", err)
+			}
+
+			if err := parseFmtChunk(chunk, &header); err != nil {
+				return nil, err
+			}
+			haveFmt = true
+
+		case "data":
+			if !haveFmt {
+				return nil, errors.New("data chunk precedes fmt chunk")
+			}
+
+			header.DataOffset = offset
+			header.DataSize = chunkSize
+
+			// streamed files may carry a bogus size, so trust the file length instead
+			if end, err := r.Seek(0, io.SeekEnd); err == nil && (chunkSize == 0 || offset+chunkSize > end) {
+				header.DataSize = end - offset
+			}
+
+			header.DataSize -= header.DataSize % int64(header.FrameSize())
+
+			return &header, nil
+
+		default:
+			// other chunks, like LIST, are skipped without reading them, whatever their size
+			if _, err := r.Seek(chunkSize, io.SeekCurrent); err != nil {
+				return nil, err
+			}
+		}
+
+		// chunks are padded to an even size
+		if chunkSize%2 == 1 {
+			if _, err := r.Seek(1, io.SeekCurrent); err != nil {
+				return nil, err
+			}
+			chunkSize++
+		}
+
+		offset += chunkSize
+	}
+}
+
+func parseFmtChunk(chunk []byte, header *WavHeader) error {
+	if len(chunk) < 16 {
+		return fmt.Errorf("fmt chunk is too short: %d", len(chunk))
+	}
+
+	audioFormat := binary.LittleEndian.Uint16(chunk[0:2])
+	channels := binary.LittleEndian.Uint16(chunk[2:4])
+	sampleRate := binary.LittleEndian.Uint32(chunk[4:8])
+	bitsPerSample := binary.LittleEndian.Uint16(chunk[14:16])
+
+	if audioFormat == wavFormatExtensible {
+		if len(chunk) < 26 {
+			return errors.New("extensible fmt chunk is too short")
+		}
+
+		// the first two bytes of the sub-format GUID hold the actual format code
+		audioFormat = binary.LittleEndian.Uint16(chunk[24:26])
+	}
+
+	if channels == 0 || sampleRate == 0 {
+		return fmt.Errorf("invalid fmt chunk: %d channels, %d Hz", channels, sampleRate)
+	}
+
+	format := FormatUnknown
+	switch {
+	case audioFormat == wavFormatPCM && bitsPerSample == 8:
+		format = FormatU8
+	case audioFormat == wavFormatPCM && bitsPerSample == 16:
+		format = FormatS16
+	case audioFormat == wavFormatPCM && bitsPerSample == 24:
+		format = FormatS24
+	case audioFormat == wavFormatPCM && bitsPerSample == 32:
+		format = FormatS32
+	case audioFormat == wavFormatIEEEFloat && bitsPerSample == 32:
+		format = FormatF32
+	default:
+		return fmt.Errorf("unsupported WAV encoding: format 0x%04x, %d bits", audioFormat, bitsPerSample)
+	}
+
+	header.Format = format
+	header.Channels = int(channels)
+	header.SampleRate = int(sampleRate)
+
+	return nil
+}
+
+const (
+	wavHeaderSize = 44
+
+	// the RIFF chunk size is 32-bit, so a file can't be larger than this
+	wavMaxFileSize = math.MaxUint32 + 8
+)
+
+type WavWriter struct {
+	file *os.File
+
+	format     Format
+	channels   int
+	sampleRate int
+
+	DataSize int64
+}
+
+func NewWavWriter(path string, format Format, channels int, sampleRate int) (*WavWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &WavWriter{
+		file: file,
+
+		format:     format,
+		channels:   channels,
+		sampleRate: sampleRate,
+	}
+
+	if err := w.WriteHeader(); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	// WriteAt doesn't move the offset that the data is written at
+	if _, err := file.Seek(wavHeaderSize, io.SeekStart); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *WavWriter) Write(data []byte) error {
+	n, err := w.file.Write(data)
+	w.DataSize += int64(n)
+
+	return err
+}
+
+// WriteHeader updates the header with the current data size, so that the file
+// is valid even if the writer is never closed
+func (w *WavWriter) WriteHeader() error {
+	audioFormat := uint16(wavFormatPCM)
+	if w.format == FormatF32 {
+		audioFormat = wavFormatIEEEFloat
+	}
+
+	sampleSize := w.format.BytesPerSample()
+	header := make([]byte, wavHeaderSize)
+
+	copy(header[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:8], uint32(wavHeaderSize-8+w.DataSize+w.DataSize%2))
+	copy(header[8:12], "WAVE")
+
+	copy(header[12:16], "fmt ")
+	binary.LittleEndian.PutUint32(header[16:20], 16)
+	binary.LittleEndian.PutUint16(header[20:22], audioFormat)
+	binary.LittleEndian.PutUint16(header[22:24], uint16(w.channels))
+	binary.LittleEndian.PutUint32(header[24:28], uint32(w.sampleRate))
+	binary.LittleEndian.PutUint32(header[28:32], uint32(w.sampleRate*w.channels*sampleSize))
+	binary.LittleEndian.PutUint16(header[32:34], uint16(w.channels*sampleSize))
+	binary.LittleEndian.PutUint16(header[34:36], uint16(sampleSize*8))
+
+	copy(header[36:40], "data")
+	binary.LittleEndian.PutUint32(header[40:44], uint32(w.DataSize))
+
+	_, err := w.file.WriteAt(header, 0)
+	return err
+}
+
+func (w *WavWriter) Close() error {
+	var err error
+
+	// chunks are padded to an even size, the pad byte isn't part of the data size
+	if w.DataSize%2 == 1 {
+		_, err = w.file.Write([]byte{0})
+	}
+
+	if headerErr := w.WriteHeader(); err == nil {
+		err = headerErr
+	}
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
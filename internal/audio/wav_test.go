@@ -0,0 +1,222 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func wavChunk(id string, size uint32, body []byte) []byte {
+	chunk := make([]byte, 8, 8+len(body)+1)
+	copy(chunk, id)
+	binary.LittleEndian.PutUint32(chunk[4:], size)
+
+	chunk = append(chunk, body...)
+	if len(body)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+
+	return chunk
+}
+
+func fmtBody(audioFormat uint16, channels uint16, sampleRate uint32, bits uint16) []byte {
+	body := make([]byte, 16)
+	binary.LittleEndian.PutUint16(body[0:], audioFormat)
+	binary.LittleEndian.PutUint16(body[2:], channels)
+	binary.LittleEndian.PutUint32(body[4:], sampleRate)
+	binary.LittleEndian.PutUint32(body[8:], sampleRate*uint32(channels)*uint32(bits/8))
+	binary.LittleEndian.PutUint16(body[12:], channels*bits/8)
+	binary.LittleEndian.PutUint16(body[14:], bits)
+
+	return body
+}
+
+func extensibleFmtBody(subFormat uint16, channels uint16, sampleRate uint32, bits uint16) []byte {
+	body := fmtBody(wavFormatExtensible, channels, sampleRate, bits)
+
+	extension := make([]byte, 24)
+	binary.LittleEndian.PutUint16(extension[0:], 22)
+	binary.LittleEndian.PutUint16(extension[2:], bits)
+	binary.LittleEndian.PutUint16(extension[8:], subFormat)
+
+	return append(body, extension...)
+}
+
+func wavFile(chunks ...[]byte) []byte {
+	body := []byte("WAVE")
+	for _, c := range chunks {
+		body = append(body, c...)
+	}
+
+	file := []byte("RIFF")
+	file = append(file, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(file[4:], uint32(len(body)))
+
+	return append(file, body...)
+}
+
+func TestReadWavHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		file []byte
+		want WavHeader
+	}{
+		{
+			name: "pcm 16-bit",
+			file: wavFile(wavChunk("fmt ", 16, fmtBody(wavFormatPCM, 2, 44100, 16)), wavChunk("data", 8, make([]byte, 8))),
+			want: WavHeader{Format: FormatS16, Channels: 2, SampleRate: 44100, DataOffset: 44, DataSize: 8},
+		},
+		{
+			name: "pcm 24-bit",
+			file: wavFile(wavChunk("fmt ", 16, fmtBody(wavFormatPCM, 1, 48000, 24)), wavChunk("data", 9, make([]byte, 9))),
+			want: WavHeader{Format: FormatS24, Channels: 1, SampleRate: 48000, DataOffset: 44, DataSize: 9},
+		},
+		{
+			name: "extensible float",
+			file: wavFile(wavChunk("fmt ", 40, extensibleFmtBody(wavFormatIEEEFloat, 2, 96000, 32)), wavChunk("data", 16, make([]byte, 16))),
+			want: WavHeader{Format: FormatF32, Channels: 2, SampleRate: 96000, DataOffset: 68, DataSize: 16},
+		},
+		{
+			name: "extensible 24-bit",
+			file: wavFile(wavChunk("fmt ", 40, extensibleFmtBody(wavFormatPCM, 2, 44100, 24)), wavChunk("data", 12, make([]byte, 12))),
+			want: WavHeader{Format: FormatS24, Channels: 2, SampleRate: 44100, DataOffset: 68, DataSize: 12},
+		},
+		{
+			name: "odd-sized chunk before data",
+			file: wavFile(
+				wavChunk("fmt ", 16, fmtBody(wavFormatPCM, 1, 8000, 8)),
+				wavChunk("LIST", 3, []byte("abc")),
+				wavChunk("data", 5, make([]byte, 5)),
+			),
+			want: WavHeader{Format: FormatU8, Channels: 1, SampleRate: 8000, DataOffset: 56, DataSize: 5},
+		},
+		{
+			name: "streamed without data size",
+			file: wavFile(wavChunk("fmt ", 16, fmtBody(wavFormatPCM, 2, 44100, 16)), wavChunk("data", 0, make([]byte, 10))),
+			want: WavHeader{Format: FormatS16, Channels: 2, SampleRate: 44100, DataOffset: 44, DataSize: 8},
+		},
+		{
+			name: "data size beyond the end",
+			file: wavFile(wavChunk("fmt ", 16, fmtBody(wavFormatPCM, 1, 44100, 16)), wavChunk("data", 1000, nil)[:8], make([]byte, 6)),
+			want: WavHeader{Format: FormatS16, Channels: 1, SampleRate: 44100, DataOffset: 44, DataSize: 6},
+		},
+		{
+			name: "empty unknown chunk",
+			file: wavFile(
+				wavChunk("fmt ", 16, fmtBody(wavFormatPCM, 1, 44100, 16)),
+				wavChunk("junk", 0, nil),
+				wavChunk("data", 2, make([]byte, 2)),
+			),
+			want: WavHeader{Format: FormatS16, Channels: 1, SampleRate: 44100, DataOffset: 52, DataSize: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, err := ReadWavHeader(bytes.NewReader(tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if *header != tt.want {
+				t.Errorf("got %+v, want %+v", *header, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadWavHeaderRejects(t *testing.T) {
+	hugeFmt := wavChunk("fmt ", 0xFFFFFFF0, nil)
+
+	tests := []struct {
+		name string
+		file []byte
+	}{
+		{"not a wav file", []byte("RIFF\x00\x00\x00\x00AVI LIST")},
+		{"truncated", []byte("RIFF")},
+		{"huge fmt chunk", wavFile(hugeFmt)},
+		{"short fmt chunk", wavFile(wavChunk("fmt ", 8, make([]byte, 8)))},
+		{"data before fmt", wavFile(wavChunk("data", 4, make([]byte, 4)))},
+		{"no data chunk", wavFile(wavChunk("fmt ", 16, fmtBody(wavFormatPCM, 1, 44100, 16)))},
+		{"unknown chunk larger than the file", wavFile(wavChunk("fmt ", 16, fmtBody(wavFormatPCM, 1, 44100, 16)), wavChunk("LIST", 0xFFFFFFF0, nil))},
+		{"unsupported encoding", wavFile(wavChunk("fmt ", 16, fmtBody(0x0055, 2, 44100, 16)), wavChunk("data", 4, make([]byte, 4)))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadWavHeader(bytes.NewReader(tt.file)); err == nil {
+				t.Error("header was accepted")
+			}
+		})
+	}
+}
+
+func TestWavWriterPadsOddData(t *testing.T) {
+	dir, err := ioutil.TempDir("", "luxaudio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	tests := []struct {
+		name     string
+		format   Format
+		channels int
+		frames   int
+	}{
+		{"empty", FormatU8, 1, 0},
+		{"u8 mono, odd frames", FormatU8, 1, 3},
+		{"u8 mono, even frames", FormatU8, 1, 4},
+		{"s24 mono, odd frames", FormatS24, 1, 5},
+		{"s24 stereo, odd frames", FormatS24, 2, 5},
+		{"s16 mono, odd frames", FormatS16, 1, 5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, "padded.wav")
+			w, err := NewWavWriter(path, test.format, test.channels, 48000)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dataSize := test.frames * test.channels * test.format.BytesPerSample()
+			data := bytes.Repeat([]byte{0x55}, dataSize)
+			if err := w.Write(data); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			file, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := wavHeaderSize + dataSize + dataSize%2; len(file) != want {
+				t.Errorf("file is %d bytes, want %d", len(file), want)
+			}
+			if riffSize := int(binary.LittleEndian.Uint32(file[4:8])); riffSize != len(file)-8 {
+				t.Errorf("RIFF size = %d, want %d", riffSize, len(file)-8)
+			}
+			if chunkSize := int(binary.LittleEndian.Uint32(file[40:44])); chunkSize != dataSize {
+				t.Errorf("data chunk size = %d, want %d", chunkSize, dataSize)
+			}
+			if dataSize%2 == 1 && file[len(file)-1] != 0 {
+				t.Errorf("pad byte = %#x, want 0", file[len(file)-1])
+			}
+
+			header, err := ReadWavHeader(bytes.NewReader(file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if header.DataSize != int64(dataSize) {
+				t.Errorf("read back %d bytes of data, want %d", header.DataSize, dataSize)
+			}
+		})
+	}
+}
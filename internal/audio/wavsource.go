@@ -0,0 +1,135 @@
+package audio
+
+import (
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+type WavFileSource struct {
+	file   *os.File
+	header *WavHeader
+
+	realtime bool
+	loop     bool
+
+	periodFrames int
+
+	stop   chan struct{}
+	errors chan error
+}
+
+func NewWavFileSource(path string, realtime bool, loop bool) (*WavFileSource, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := ReadWavHeader(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	if header.DataSize == 0 {
+		_ = file.Close()
+		return nil, errors.New("WAV file contains no audio data")
+	}
+
+	return &WavFileSource{
+		file:   file,
+		header: header,
+
+		realtime: realtime,
+		loop:     loop,
+
+		periodFrames: getPeriodFrames(header.SampleRate),
+
+		stop:   make(chan struct{}),
+		errors: make(chan error, 1),
+	}, nil
+}
+
+func (s *WavFileSource) Start(onData DataCallback) error {
+	go func() {
+		err := s.run(onData)
+		_ = s.file.Close()
+
+		if err == nil {
+			err = io.EOF
+		}
+		s.errors <- err
+	}()
+
+	return nil
+}
+
+func (s *WavFileSource) Stop() error {
+	close(s.stop)
+	return nil
+}
+
+func (s *WavFileSource) Format() Format {
+	return s.header.Format
+}
+
+func (s *WavFileSource) Channels() int {
+	return s.header.Channels
+}
+
+func (s *WavFileSource) SampleRate() int {
+	return s.header.SampleRate
+}
+
+func (s *WavFileSource) Errors() <-chan error {
+	return s.errors
+}
+
+func (s *WavFileSource) run(onData DataCallback) error {
+	frameSize := s.header.FrameSize()
+	buf := make([]byte, s.periodFrames*frameSize)
+
+	start := time.Now()
+	framesPlayed := int64(0)
+
+	for {
+		if _, err := s.file.Seek(s.header.DataOffset, io.SeekStart); err != nil {
+			return err
+		}
+		reader := io.LimitReader(s.file, s.header.DataSize)
+
+		for {
+			select {
+			case <-s.stop:
+				return nil
+			default:
+			}
+
+			n, err := io.ReadFull(reader, buf)
+			n -= n % frameSize
+
+			if n > 0 {
+				frameCount := n / frameSize
+				onData(buf[:n], uint32(frameCount))
+				framesPlayed += int64(frameCount)
+
+				if s.realtime {
+					due := start.Add(time.Duration(framesPlayed) * time.Second / time.Duration(s.header.SampleRate))
+					time.Sleep(time.Until(due))
+				}
+			}
+
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		if !s.loop {
+			return nil
+		}
+	}
+}
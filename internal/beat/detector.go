@@ -0,0 +1,213 @@
+package beat
+
+import (
+	"github.com/ivkos/luxaudio/internal/utils"
+	"gonum.org/v1/gonum/dsp/fourier"
+	"gonum.org/v1/gonum/stat"
+	"math"
+	"math/cmplx"
+	"time"
+)
+
+const (
+	// onsets are detected with a shorter FFT than the spectrum, for a better time resolution
+	detectorFftSize = 1024
+
+	// compression of the magnitudes, so that quiet onsets count too
+	logCompression = 100
+
+	// the threshold adapts to the flux over this long
+	thresholdHistory = 1 * time.Second
+)
+
+// Event is an onset, which is a likely beat
+type Event struct {
+	// time since the input started, at the end of the analyzed window
+	Time time.Duration
+
+	// how many times the flux exceeded the threshold, at least 1
+	Strength float64
+}
+
+type Listener = func(e Event)
+
+type TempoListener = func(t Tempo)
+
+// Detector finds onsets as peaks of the spectral flux, which is the increase of the magnitudes between
+// two hops, optionally only between low and high, e.g. for the kick drum. An onset is detected when the
+// flux exceeds the mean of the recent flux by sensitivity standard deviations, at most once per minInterval.
+// No onsets are detected during the first thresholdHistory, while the threshold adapts.
+type Detector struct {
+	channels   int
+	hopSize    int
+	sampleRate float64
+
+	sensitivity float64
+	minInterval time.Duration
+
+	fftSize  int
+	window   []float64
+	fft      *fourier.FFT
+	mono     []float64
+	loBin    int
+	hiBin    int
+	previous []float64
+
+	history       []float64
+	historyIndex  int
+	historyFilled bool
+
+	// number of frames processed so far
+	position  int64
+	lastOnset time.Duration
+	rising    bool
+
+	tracker *Tracker
+
+	listeners      []Listener
+	tempoListeners []TempoListener
+}
+
+func NewDetector(
+	fftSize int,
+	hopSize int,
+	channels int,
+	sampleRate float64,
+	low float64,
+	high float64,
+	sensitivity float64,
+	minInterval time.Duration,
+) *Detector {
+	// every sample has to be seen, so that short onsets aren't missed with large hops
+	size := detectorFftSize
+	if hopSize > size {
+		size = hopSize
+	}
+	if fftSize < size {
+		size = fftSize
+	}
+
+	binWidth := sampleRate / float64(size)
+	binCount := size/2 + 1
+
+	loBin := int(math.Ceil(low / binWidth))
+	hiBin := binCount - 1
+	if high > 0 {
+		hiBin = int(math.Min(math.Floor(high/binWidth), float64(binCount-1)))
+	}
+	if loBin > hiBin {
+		loBin = hiBin
+	}
+
+	hopsPerSecond := sampleRate / float64(hopSize)
+	historyLength := int(math.Max(thresholdHistory.Seconds()*hopsPerSecond, 2))
+
+	return &Detector{
+		channels:   channels,
+		hopSize:    hopSize,
+		sampleRate: sampleRate,
+
+		sensitivity: sensitivity,
+		minInterval: minInterval,
+
+		fftSize:  size,
+		window:   utils.GetHannWindow(size),
+		fft:      fourier.NewFFT(size),
+		mono:     make([]float64, size),
+		loBin:    loBin,
+		hiBin:    hiBin,
+		previous: make([]float64, binCount),
+
+		history: make([]float64, historyLength),
+
+		lastOnset: -minInterval,
+
+		tracker: NewTracker(hopsPerSecond),
+
+		listeners:      make([]Listener, 0),
+		tempoListeners: make([]TempoListener, 0),
+	}
+}
+
+// Subscribe adds a listener, which is called on the analysis goroutine, before the effect is applied
+func (d *Detector) Subscribe(listener Listener) {
+	d.listeners = append(d.listeners, listener)
+}
+
+// SubscribeTempo adds a listener which is called after every hop, like the beat listeners
+func (d *Detector) SubscribeTempo(listener TempoListener) {
+	d.tempoListeners = append(d.tempoListeners, listener)
+}
+
+// Tempo returns the latest state of the tempo tracker, it's safe to call from any goroutine
+func (d *Detector) Tempo() Tempo {
+	return d.tracker.Tempo()
+}
+
+// Process must be given the interleaved analysis window after every hop
+func (d *Detector) Process(window []float64) {
+	d.position += int64(d.hopSize)
+	now := time.Duration(float64(d.position) / d.sampleRate * float64(time.Second))
+
+	// downmix the most recent samples
+	start := len(window)/d.channels - d.fftSize
+	for i := range d.mono {
+		sum := 0.0
+		for c := 0; c < d.channels; c++ {
+			sum += window[(start+i)*d.channels+c]
+		}
+		d.mono[i] = sum / float64(d.channels) * d.window[i]
+	}
+
+	ffs := d.fft.Coefficients(nil, d.mono)
+
+	flux := 0.0
+	for i := range d.previous {
+		magnitude := math.Log1p(logCompression * cmplx.Abs(ffs[i]) / float64(d.fftSize))
+
+		if i >= d.loBin && i <= d.hiBin && magnitude > d.previous[i] {
+			flux += magnitude - d.previous[i]
+		}
+
+		d.previous[i] = magnitude
+	}
+
+	mean, std := stat.MeanStdDev(d.history, nil)
+	threshold := mean + d.sensitivity*std
+
+	// until the history is filled, the threshold is too low, and the start of the input would count as an onset
+	filled := d.historyFilled
+
+	d.history[d.historyIndex] = flux
+	d.historyIndex = (d.historyIndex + 1) % len(d.history)
+	d.historyFilled = d.historyFilled || d.historyIndex == 0
+
+	// only the first hop above the threshold counts, a loud onset spans a few
+	above := filled && flux > threshold && flux > 0
+	onset := above && !d.rising && now-d.lastOnset >= d.minInterval
+	d.rising = above
+
+	tempo := d.tracker.Update(now, flux, onset)
+
+	if onset {
+		d.lastOnset = now
+
+		strength := 1.0
+		if threshold > 0 {
+			strength = flux / threshold
+		}
+
+		e := Event{
+			Time:     now,
+			Strength: strength,
+		}
+
+		for _, listener := range d.listeners {
+			listener(e)
+		}
+	}
+
+	for _, listener := range d.tempoListeners {
+		listener(tempo)
+	}
+}
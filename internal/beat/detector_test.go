@@ -0,0 +1,123 @@
+package beat_test
+
+import (
+	"encoding/binary"
+	"github.com/ivkos/luxaudio/internal/audio"
+	"github.com/ivkos/luxaudio/internal/beat"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	testSampleRate = 44100
+	testFftSize    = 2048
+	testHopSize    = 512
+)
+
+// writeClickTrain writes a WAV file of a tone, which starts abruptly, with loud clicks at the given times.
+// The tone repeats exactly every hop, so it has no flux after its start.
+func writeClickTrain(t *testing.T, path string, duration time.Duration, clicks []time.Duration) {
+	w, err := audio.NewWavWriter(path, audio.FormatF32, 1, testSampleRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const period = testHopSize / 8
+
+	samples := make([]float64, int(duration.Seconds()*testSampleRate))
+	for i := range samples {
+		samples[i] = 0.3 * math.Sin(2*math.Pi*float64(i%period)/period)
+	}
+
+	for _, click := range clicks {
+		samples[int(click.Seconds()*testSampleRate)] = 0.8
+	}
+
+	data := make([]byte, len(samples)*4)
+	for i, x := range samples {
+		binary.LittleEndian.PutUint32(data[i*4:], math.Float32bits(float32(x)))
+	}
+
+	if err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// detectBeats plays a mono float WAV file through a detector, like the analysis queue does
+func detectBeats(t *testing.T, path string) []beat.Event {
+	source, err := audio.NewWavFileSource(path, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	detector := beat.NewDetector(testFftSize, testHopSize, 1, testSampleRate, 0, 0, 1.5, 100*time.Millisecond)
+
+	events := make([]beat.Event, 0)
+	detector.Subscribe(func(e beat.Event) {
+		events = append(events, e)
+	})
+
+	window := make([]float64, testFftSize)
+	pending := 0
+
+	err = source.Start(func(data []byte, frameCount uint32) {
+		for i := 0; i < int(frameCount); i++ {
+			copy(window, window[1:])
+			window[len(window)-1] = float64(math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:])))
+
+			pending++
+			if pending == testHopSize {
+				detector.Process(window)
+				pending = 0
+			}
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-source.Errors(); err != io.EOF {
+		t.Fatal(err)
+	}
+
+	return events
+}
+
+func TestDetectorFindsClicks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "luxaudio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	// the start of the tone isn't a beat, and the first second is left for the threshold to adapt
+	clicks := make([]time.Duration, 0)
+	for c := 1500 * time.Millisecond; c < 6*time.Second; c += 500 * time.Millisecond {
+		clicks = append(clicks, c)
+	}
+
+	path := filepath.Join(dir, "clicks.wav")
+	writeClickTrain(t, path, 6*time.Second, clicks)
+
+	events := detectBeats(t, path)
+	if len(events) != len(clicks) {
+		t.Fatalf("detected %d beats, want %d: %v", len(events), len(clicks), events)
+	}
+
+	// a click is detected at the end of the first or second hop that contains it, depending on
+	// how much of it the window lets through
+	hop := time.Duration(testHopSize) * time.Second / testSampleRate
+	for i, e := range events {
+		if e.Time < clicks[i] || e.Time > clicks[i]+2*hop {
+			t.Errorf("beat %d detected at %v, want between %v and %v", i, e.Time, clicks[i], clicks[i]+2*hop)
+		}
+	}
+}
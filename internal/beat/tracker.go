@@ -0,0 +1,257 @@
+package beat
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	minBpm = 60
+	maxBpm = 200
+
+	// the tempo is estimated from the flux over this long
+	tempoHistory = 6 * time.Second
+
+	// the flux is smoothed over about this long before estimating the tempo
+	tempoSmoothing = 50 * time.Millisecond
+
+	// how often the tempo is estimated
+	tempoInterval = 500 * time.Millisecond
+
+	// tempos further apart are considered a change of tempo rather than drift
+	tempoTolerance = 0.04
+
+	// estimates that have to agree on a new tempo before switching to it
+	tempoRelock = 2
+
+	// onsets within this fraction of a period from the expected beat pull the phase towards them
+	phaseWindow = 0.25
+	phasePull   = 0.5
+)
+
+// Tempo is the state of the tempo tracker
+type Tempo struct {
+	Bpm float64
+
+	// number of beats since the tempo was first detected, with the phase of the current beat as the fraction
+	Beats float64
+
+	// how periodic the onsets are at Bpm, from 0 to 1
+	Confidence float64
+}
+
+// Tracker estimates the tempo from the autocorrelation of the spectral flux, preferring tempos around
+// 120 BPM, and keeps track of the beats by letting onsets near the expected beats adjust the phase.
+type Tracker struct {
+	hopsPerSecond float64
+
+	flux      []float64
+	fluxIndex int
+	hops      int
+
+	// in hops
+	period      float64
+	candidate   float64
+	disagreeing int
+	confidence  float64
+
+	beat     int64
+	lastBeat time.Duration
+	locked   bool
+
+	mutex sync.Mutex
+	tempo Tempo
+}
+
+func NewTracker(hopsPerSecond float64) *Tracker {
+	return &Tracker{
+		hopsPerSecond: hopsPerSecond,
+
+		flux: make([]float64, int(tempoHistory.Seconds()*hopsPerSecond)),
+	}
+}
+
+// Tempo returns the latest state, it's safe to call from any goroutine
+func (t *Tracker) Tempo() Tempo {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.tempo
+}
+
+// Update must be called after every hop with its flux, and whether there was an onset
+func (t *Tracker) Update(now time.Duration, flux float64, onset bool) Tempo {
+	t.flux[t.fluxIndex] = flux
+	t.fluxIndex = (t.fluxIndex + 1) % len(t.flux)
+	t.hops++
+
+	if t.hops >= len(t.flux)/2 && t.hops%int(math.Max(tempoInterval.Seconds()*t.hopsPerSecond, 1)) == 0 {
+		t.estimate()
+	}
+
+	tempo := Tempo{}
+	if t.period > 0 {
+		period := time.Duration(t.period / t.hopsPerSecond * float64(time.Second))
+		t.followBeats(now, period, onset)
+
+		tempo = Tempo{
+			Bpm:        60 * t.hopsPerSecond / t.period,
+			Beats:      float64(t.beat) + math.Min(float64(now-t.lastBeat)/float64(period), 1),
+			Confidence: t.confidence,
+		}
+	}
+
+	t.mutex.Lock()
+	t.tempo = tempo
+	t.mutex.Unlock()
+
+	return tempo
+}
+
+func (t *Tracker) estimate() {
+	n := len(t.flux)
+	if t.hops < n {
+		n = t.hops
+	}
+
+	// the flux in chronological order
+	flux := make([]float64, n)
+	for i := range flux {
+		flux[i] = t.flux[(t.fluxIndex-n+i+len(t.flux))%len(t.flux)]
+	}
+
+	// onsets are often a single hop long, so smooth them to get autocorrelation peaks
+	// that aren't missed between two lags, and remove the mean
+	radius := int(math.Ceil(tempoSmoothing.Seconds() * t.hopsPerSecond))
+	signal := make([]float64, n)
+	mean := 0.0
+	for i := range signal {
+		sum, weights := 0.0, 0.0
+		for j := -radius; j <= radius; j++ {
+			if i+j >= 0 && i+j < n {
+				w := float64(radius + 1 - abs(j))
+				sum += w * flux[i+j]
+				weights += w
+			}
+		}
+		signal[i] = sum / weights
+		mean += signal[i]
+	}
+	mean /= float64(n)
+	for i := range signal {
+		signal[i] -= mean
+	}
+
+	autocorrelation := func(lag int) float64 {
+		sum := 0.0
+		for i := lag; i < n; i++ {
+			sum += signal[i] * signal[i-lag]
+		}
+		return sum / float64(n-lag)
+	}
+
+	energy := autocorrelation(0)
+	if energy <= 0 {
+		t.confidence = 0
+		return
+	}
+
+	minLag := int(math.Floor(60 * t.hopsPerSecond / maxBpm))
+	maxLag := int(math.Ceil(60 * t.hopsPerSecond / minBpm))
+	if minLag < 1 {
+		minLag = 1
+	}
+	if maxLag > n/2 {
+		maxLag = n / 2
+	}
+	if minLag+2 > maxLag {
+		return
+	}
+
+	values := make([]float64, maxLag+2)
+	for lag := minLag - 1; lag <= maxLag+1; lag++ {
+		if lag >= 1 {
+			values[lag] = autocorrelation(lag)
+		}
+	}
+
+	bestLag := 0
+	bestScore := math.Inf(-1)
+	for lag := minLag; lag <= maxLag; lag++ {
+		bpm := 60 * t.hopsPerSecond / float64(lag)
+		weight := math.Exp(-0.5 * math.Pow(math.Log2(bpm/120), 2))
+
+		if score := values[lag] * weight; score > bestScore {
+			bestScore = score
+			bestLag = lag
+		}
+	}
+
+	// refine between the lags with a parabola through the neighbours
+	period := float64(bestLag)
+	a, b, c := values[bestLag-1], values[bestLag], values[bestLag+1]
+	if d := a - 2*b + c; d < 0 {
+		period += 0.5 * (a - c) / d
+	}
+
+	t.confidence = math.Max(0, math.Min(values[bestLag]/energy, 1))
+
+	switch {
+	case t.period == 0 || math.Abs(period-t.period)/t.period <= tempoTolerance:
+		if t.period == 0 {
+			t.period = period
+		} else {
+			t.period += (period - t.period) / 2
+		}
+		t.disagreeing = 0
+
+	case t.disagreeing > 0 && math.Abs(period-t.candidate)/t.candidate <= tempoTolerance:
+		t.disagreeing++
+		if t.disagreeing >= tempoRelock {
+			t.period = period
+			t.disagreeing = 0
+
+			// the old beats are too far off for onsets to pull them into phase, so start over from the next one
+			t.locked = false
+		}
+
+	default:
+		t.candidate = period
+		t.disagreeing = 1
+	}
+}
+
+func (t *Tracker) followBeats(now time.Duration, period time.Duration, onset bool) {
+	if !t.locked {
+		if onset {
+			t.lastBeat = now
+			t.locked = true
+		}
+		return
+	}
+
+	if onset {
+		// how far the onset is from the closest expected beat
+		offset := (now - t.lastBeat) % period
+		if offset > period/2 {
+			offset -= period
+		}
+
+		if math.Abs(float64(offset)) <= phaseWindow*float64(period) {
+			t.lastBeat += time.Duration(phasePull * float64(offset))
+		}
+	}
+
+	for now-t.lastBeat >= period {
+		t.lastBeat += period
+		t.beat++
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,97 @@
+package beat_test
+
+import (
+	"github.com/ivkos/luxaudio/internal/beat"
+	"math"
+	"testing"
+	"time"
+)
+
+// tempoSegment is a click train at a steady tempo
+type tempoSegment struct {
+	bpm      float64
+	duration time.Duration
+}
+
+// trackClicks feeds a tracker the flux of click trains, one after another, and returns its tempo after every hop
+func trackClicks(segments []tempoSegment) ([]beat.Tempo, time.Duration) {
+	hopsPerSecond := float64(testSampleRate) / testHopSize
+	hop := time.Duration(float64(time.Second) / hopsPerSecond)
+
+	tracker := beat.NewTracker(hopsPerSecond)
+	tempos := make([]beat.Tempo, 0)
+
+	now := time.Duration(0)
+	for _, segment := range segments {
+		period := time.Duration(float64(time.Minute) / segment.bpm)
+		next := now
+
+		for end := now + segment.duration; now < end; now += hop {
+			// a click is in the flux of the hop that it falls in
+			onset := next < now+hop
+			flux := 0.0
+			if onset {
+				flux = 1
+				next += period
+			}
+
+			tempos = append(tempos, tracker.Update(now, flux, onset))
+		}
+	}
+
+	return tempos, hop
+}
+
+func TestTrackerRelocksAfterTempoChange(t *testing.T) {
+	const (
+		change = 12 * time.Second
+		// the tempo estimate looks 6 s back, and needs two estimates to agree on a change
+		maxRelock = 5 * time.Second
+	)
+
+	tempos, hop := trackClicks([]tempoSegment{{120, change}, {150, 12 * time.Second}})
+
+	tests := []struct {
+		name string
+		// where the click train of the tempo starts
+		start time.Duration
+		from  time.Duration
+		to    time.Duration
+		bpm   float64
+	}{
+		{"before the change", 0, change - 2*time.Second, change, 120},
+		{"after the change", change, change + maxRelock, time.Duration(len(tempos)) * hop, 150},
+	}
+
+	for _, test := range tests {
+		period := time.Duration(float64(time.Minute) / test.bpm)
+		click := test.start
+		clicks := 0
+
+		for i := int(test.from / hop); i < int(test.to/hop); i++ {
+			tempo := tempos[i]
+			if math.Abs(tempo.Bpm-test.bpm) > 2 || tempo.Confidence < 0.2 {
+				t.Errorf("%s: tracking %.1f BPM with a confidence of %.2f at %v, want %.0f BPM",
+					test.name, tempo.Bpm, tempo.Confidence, time.Duration(i)*hop, test.bpm)
+				break
+			}
+
+			// and the beats fall on the clicks
+			now := time.Duration(i) * hop
+			for click < now {
+				click += period
+			}
+			if click < now+hop {
+				clicks++
+				if _, phase := math.Modf(tempo.Beats + 0.5); math.Abs(phase-0.5) > 0.1 {
+					t.Errorf("%s: a click at %v is at beat %.2f", test.name, click, tempo.Beats)
+					break
+				}
+			}
+		}
+
+		if clicks == 0 {
+			t.Errorf("%s: no clicks were checked", test.name)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package effects
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"time"
+)
+
+const (
+	breathingPeriod   = 6 * time.Second
+	breathingInterval = 50 * time.Millisecond
+
+	// static frames only need to be repeated in case a packet gets lost
+	staticInterval = 1 * time.Second
+
+	ambientLevel = 0.3
+)
+
+// IdleEffect is shown instead of the audio-reactive effect while the input is silent.
+// It ignores the intensities and animates on its own.
+type IdleEffect struct {
+	mode  string
+	color color.RGBA
+	start time.Time
+
+	ledCount int
+	ledData  []byte
+}
+
+func NewIdleEffect(mode string, ledCount int, color color.RGBA) (*IdleEffect, error) {
+	switch mode {
+	case "off", "breathing", "ambient":
+	default:
+		return nil, fmt.Errorf("unsupported idle effect: %s", mode)
+	}
+
+	return &IdleEffect{
+		mode:  mode,
+		color: color,
+		start: time.Now(),
+
+		ledCount: ledCount,
+		ledData:  make([]byte, ledCount*3),
+	}, nil
+}
+
+func (e *IdleEffect) Apply(_ []float64) []byte {
+	var level float64
+	switch e.mode {
+	case "breathing":
+		// starts dark, so it blends in from a silent strip
+		phase := 2 * math.Pi * time.Since(e.start).Seconds() / breathingPeriod.Seconds()
+		level = ambientLevel * (1 - math.Cos(phase)) / 2
+
+	case "ambient":
+		level = ambientLevel
+	}
+
+	for i := 0; i < e.ledCount; i++ {
+		e.ledData[i*3+0] = byte(float64(e.color.G) * level)
+		e.ledData[i*3+1] = byte(float64(e.color.R) * level)
+		e.ledData[i*3+2] = byte(float64(e.color.B) * level)
+	}
+
+	return e.ledData
+}
+
+// Interval tells how often the idle effect needs to be sent
+func (e *IdleEffect) Interval() time.Duration {
+	if e.mode == "breathing" {
+		return breathingInterval
+	}
+
+	return staticInterval
+}
+
+// Restart makes the animation start over
+func (e *IdleEffect) Restart() {
+	e.start = time.Now()
+}
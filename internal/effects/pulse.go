@@ -0,0 +1,69 @@
+package effects
+
+import (
+	"github.com/ivkos/luxaudio/internal/beat"
+	"image/color"
+	"math"
+	"time"
+)
+
+// BeatListener is implemented by effects that react to beats
+type BeatListener interface {
+	OnBeat(e beat.Event)
+}
+
+// TempoListener is implemented by effects that follow the tempo
+type TempoListener interface {
+	OnTempo(t beat.Tempo)
+}
+
+// PulseEffect flashes the whole strip on every beat, fading out over fadeTime, on top of the spectrum
+type PulseEffect struct {
+	color    color.RGBA
+	fadeTime time.Duration
+
+	level      float64
+	lastUpdate time.Time
+
+	ledCount int
+	ledData  []byte
+}
+
+func NewPulseEffect(ledCount int, color color.RGBA, fadeTime time.Duration) Effect {
+	return &PulseEffect{
+		color:    color,
+		fadeTime: fadeTime,
+
+		lastUpdate: time.Now(),
+
+		ledCount: ledCount,
+		ledData:  make([]byte, ledCount*3),
+	}
+}
+
+func (e *PulseEffect) OnBeat(ev beat.Event) {
+	// barely detected beats flash at half the brightness
+	e.level = math.Max(e.level, math.Min(ev.Strength/2, 1))
+}
+
+func (e *PulseEffect) Apply(intensities []float64) []byte {
+	level := e.level
+
+	now := time.Now()
+	if e.fadeTime > 0 {
+		e.level = math.Max(0, e.level-float64(now.Sub(e.lastUpdate))/float64(e.fadeTime))
+	} else {
+		e.level = 0
+	}
+	e.lastUpdate = now
+
+	for i, x := range intensities {
+		x = math.Max(x, level)
+
+		e.ledData[i*3+0] = byte(float64(e.color.G) * x)
+		e.ledData[i*3+1] = byte(float64(e.color.R) * x)
+		e.ledData[i*3+2] = byte(float64(e.color.B) * x)
+	}
+
+	return e.ledData
+}
@@ -1,23 +1,39 @@
 package effects
 
 import (
+	"github.com/ivkos/luxaudio/internal/beat"
 	"image/color"
+	"math"
+	"sync/atomic"
 	"time"
 )
 
+const (
+	// while the tempo is known, the wheel turns once every 4 bars
+	beatsPerRevolution = 16
+
+	minTempoConfidence = 0.2
+)
+
 type RainbowEffect struct {
+	// accessed atomically, the position of the wheel, which only the timer goroutine changes
+	offset int32
+
+	// the latest tempo, which the timer picks up on its next tick
+	tempos chan beat.Tempo
+
 	rate     float64
 	ledCount int
 	ledData  []byte
-	rainbow  []color.RGBA
 }
 
 func NewRainbowEffect(ledCount int, rate float64) Effect {
 	e := &RainbowEffect{
+		tempos: make(chan beat.Tempo, 1),
+
 		rate:     rate,
 		ledCount: ledCount,
 		ledData:  make([]byte, ledCount*3),
-		rainbow:  make([]color.RGBA, ledCount*3),
 	}
 
 	go e.startRainbow()
@@ -26,29 +42,65 @@ func NewRainbowEffect(ledCount int, rate float64) Effect {
 }
 
 func (e *RainbowEffect) Apply(intensities []float64) []byte {
+	offset := int(atomic.LoadInt32(&e.offset))
+
 	for i, x := range intensities {
-		e.ledData[i*3+0] = byte(float64(e.rainbow[i].G) * x)
-		e.ledData[i*3+1] = byte(float64(e.rainbow[i].R) * x)
-		e.ledData[i*3+2] = byte(float64(e.rainbow[i].B) * x)
+		c := wheel(uint8((offset + i) & 255))
+
+		e.ledData[i*3+0] = byte(float64(c.G) * x)
+		e.ledData[i*3+1] = byte(float64(c.R) * x)
+		e.ledData[i*3+2] = byte(float64(c.B) * x)
 	}
 
 	return e.ledData
 }
 
+// OnTempo replaces the tempo that the timer hasn't picked up yet, if any. It's only called by the analysis
+// worker, so nothing else fills the channel in between, and the send never blocks.
+func (e *RainbowEffect) OnTempo(t beat.Tempo) {
+	select {
+	case <-e.tempos:
+	default:
+	}
+
+	e.tempos <- t
+}
+
 func (e *RainbowEffect) startRainbow() {
-	offset := 0
 	t := time.NewTimer(0)
 	duration := time.Duration(1000/e.rate) * time.Millisecond
 
+	offset := 0
+	var tempo beat.Tempo
+
+	// while the rainbow follows the tempo, the position of the wheel at beat 0, so that it doesn't jump when the tempo takes over
+	synced := false
+	syncBase := 0.0
+
 	for {
 		t.Reset(duration)
 		<-t.C
 
-		for i := 0; i < e.ledCount; i++ {
-			e.rainbow[i] = wheel(uint8((offset + i) & 255))
+		select {
+		case tempo = <-e.tempos:
+		default:
+		}
+
+		if tempo.Confidence < minTempoConfidence {
+			synced = false
+			offset++
+		} else {
+			beats := tempo.Beats * 256 / beatsPerRevolution
+			if !synced {
+				syncBase = float64(offset) - beats
+				synced = true
+			}
+
+			offset = int(math.Floor(syncBase + beats))
 		}
 
-		offset = (offset + 1) % 256
+		offset = (offset%256 + 256) % 256
+		atomic.StoreInt32(&e.offset, int32(offset))
 	}
 }
 
@@ -0,0 +1,34 @@
+package effects
+
+import "image/color"
+
+// RedZoneEffect shows the LEDs in the zone in a different color, like the red zone of a level meter
+type RedZoneEffect struct {
+	effect Effect
+	zone   []bool
+	color  color.RGBA
+}
+
+func NewRedZoneEffect(effect Effect, zone []bool, color color.RGBA) Effect {
+	return &RedZoneEffect{
+		effect: effect,
+		zone:   zone,
+		color:  color,
+	}
+}
+
+func (e *RedZoneEffect) Apply(intensities []float64) []byte {
+	ledData := e.effect.Apply(intensities)
+
+	for i, x := range intensities {
+		if !e.zone[i] {
+			continue
+		}
+
+		ledData[i*3+0] = byte(float64(e.color.G) * x)
+		ledData[i*3+1] = byte(float64(e.color.R) * x)
+		ledData[i*3+2] = byte(float64(e.color.B) * x)
+	}
+
+	return ledData
+}
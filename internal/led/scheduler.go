@@ -0,0 +1,126 @@
+package led
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// the time between submitted frames is considered to have changed, rather than jittered,
+// when it changes by more than this factor
+const periodChange = 4
+
+// Scheduler sends the latest submitted frame on a steady clock of at most maxFps, independently of
+// how often frames are submitted. Nothing is sent until a new frame is submitted.
+// With interpolation, it fades from what was last sent to the latest frame over the time between
+// submitted frames, which delays the output by about one frame.
+type Scheduler struct {
+	send        func(ledData []byte)
+	interval    time.Duration
+	interpolate bool
+
+	mutex     sync.Mutex
+	previous  []byte
+	latest    []byte
+	fresh     bool
+	submitted time.Time
+	period    time.Duration
+
+	sent []byte
+}
+
+func NewScheduler(send func(ledData []byte), maxFps float64, interpolate bool) *Scheduler {
+	s := &Scheduler{
+		send:        send,
+		interval:    time.Duration(float64(time.Second) / maxFps),
+		interpolate: interpolate,
+
+		previous: make([]byte, 0),
+		latest:   make([]byte, 0),
+		sent:     make([]byte, 0),
+	}
+
+	go s.run()
+
+	return s
+}
+
+// Submit replaces the frame to be sent next with a copy of ledData
+func (s *Scheduler) Submit(ledData []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	if !s.submitted.IsZero() {
+		elapsed := now.Sub(s.submitted)
+
+		switch {
+		case s.period > 0 && elapsed > s.period*periodChange:
+			// a pause, e.g. while the idle effect is sent at a low rate, rather than the rate
+			// of the frames to come, so the next frame is sent without fading into it
+			s.period = 0
+
+		case s.period == 0 || elapsed < s.period/periodChange:
+			s.period = elapsed
+
+		default:
+			// smooth out the jitter between submitted frames
+			s.period += (elapsed - s.period) / 8
+		}
+	}
+	s.submitted = now
+
+	s.previous = append(s.previous[:0], s.sent...)
+	s.latest = append(s.latest[:0], ledData...)
+	s.fresh = true
+}
+
+func (s *Scheduler) run() {
+	next := time.Now()
+
+	for {
+		next = next.Add(s.interval)
+
+		now := time.Now()
+		if next.Before(now) {
+			// fell behind, e.g. because sending blocked, so don't try to catch up
+			next = now
+		}
+
+		time.Sleep(time.Until(next))
+
+		if ledData := s.next(time.Now()); ledData != nil {
+			s.send(ledData)
+		}
+	}
+}
+
+// next returns the frame to send at now, or nil if there is nothing new to send
+func (s *Scheduler) next(now time.Time) []byte {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.fresh {
+		return nil
+	}
+
+	if !s.interpolate || s.period == 0 || len(s.previous) != len(s.latest) {
+		s.fresh = false
+		s.sent = append(s.sent[:0], s.latest...)
+		return s.sent
+	}
+
+	t := float64(now.Sub(s.submitted)) / float64(s.period)
+	if t >= 1 {
+		t = 1
+		s.fresh = false
+	}
+
+	for i := range s.latest {
+		from := float64(s.previous[i])
+		to := float64(s.latest[i])
+		s.sent[i] = byte(math.Round(from + (to-from)*t))
+	}
+
+	return s.sent
+}
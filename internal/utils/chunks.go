@@ -7,6 +7,10 @@ import (
 func Chunk(data []float64, desiredChunks int) [][]float64 {
 	var divided [][]float64
 
+	if desiredChunks <= 0 {
+		return divided
+	}
+
 	chunkSize := (len(data) + desiredChunks - 1) / desiredChunks
 
 	for i := 0; i < len(data); i += chunkSize {
@@ -33,6 +37,21 @@ func ChunkedMean(data []float64, desiredChunks int) []float64 {
 	return result
 }
 
+// StretchArray repeats the elements of arr to fill total elements
+func StretchArray(arr []float64, total int) []float64 {
+	arrLen := len(arr)
+	if total <= arrLen || arrLen == 0 {
+		return arr
+	}
+
+	result := make([]float64, total)
+	for i := range result {
+		result[i] = arr[i*arrLen/total]
+	}
+
+	return result
+}
+
 func CenterArray(arr []float64, total int) []float64 {
 	arrLen := len(arr)
 	if total <= arrLen {
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChunkedMean(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []float64
+		chunks int
+		want   []float64
+	}{
+		{"even", []float64{1, 3, 5, 7}, 2, []float64{2, 6}},
+		{"uneven", []float64{1, 2, 3, 4, 5}, 2, []float64{2, 4.5}},
+		{"one", []float64{1, 2, 3}, 1, []float64{2}},
+		{"more chunks than data", []float64{1, 2}, 4, []float64{1, 2}},
+		{"zero chunks", []float64{1, 2}, 0, []float64{}},
+		{"negative chunks", []float64{1, 2}, -1, []float64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ChunkedMean(tt.data, tt.chunks); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,17 +2,43 @@ package utils
 
 import (
 	"flag"
+	"fmt"
 	"image/color"
 	"os"
 	"strconv"
+	"time"
 )
 
 type FlagsResult struct {
-	Host string
-	Port uint16
+	Host    string
+	Port    uint16
+	Offline bool
 
 	LedCount int
 	FftSize  int
+	HopSize  int
+	Fps      float64
+
+	Window     string
+	KaiserBeta float64
+
+	MaxFps      float64
+	Interpolate bool
+
+	Filter string
+
+	BeatLow         float64
+	BeatHigh        float64
+	BeatSensitivity float64
+	BeatMinInterval time.Duration
+	PrintBeats      bool
+	TempoSync       bool
+
+	Agc        bool
+	AgcTarget  float64
+	AgcAttack  time.Duration
+	AgcRelease time.Duration
+	AgcMaxGain float64
 
 	SampleRate int
 	Channels   int
@@ -20,49 +46,166 @@ type FlagsResult struct {
 	Decay         float64
 	DbfsThreshold float64
 
-	Backend string
-	Device  string
+	Backend    string
+	Device     string
+	DeviceId   string
+	DeviceName string
 
 	AudibleLow  float64
 	AudibleHigh float64
 
+	Analyzer   string
+	MelFilters int
+
+	BinsPerOctave int
+
+	Meter        string
+	MeterFloor   float64
+	RedZone      float64
+	RedZoneColor color.RGBA
+
+	Bands  string
 	Mirror bool
+	Stereo bool
 	Effect string
 
 	Color color.RGBA
 
+	SilenceThreshold float64
+	SilenceHold      time.Duration
+	IdleEffect       string
+	IdleColor        color.RGBA
+	FadeTime         time.Duration
+
+	Input    string
+	Format   string
+	Realtime bool
+	Loop     bool
+
+	Listen        string
+	Protocol      string
+	JitterPackets int
+
+	Record            string
+	RecordDownmix     bool
+	RecordMaxSize     int64
+	RecordMaxDuration time.Duration
+	RecordKeep        int
+
+	Generator          string
+	GeneratorLevel     float64
+	GeneratorFreq      float64
+	GeneratorDuration  time.Duration
+	GeneratorClickRate float64
+
 	Verbose bool
+
+	ListDevices bool
 }
 
 func GetFlags() FlagsResult {
+	listDevices := len(os.Args) > 1 && os.Args[1] == "devices"
+
 	var host = flag.String("host", "", "host of the luxsrv")
 	var port = flag.Uint("port", DefaultPort, "port of the luxsrv")
+	var offline = flag.Bool("offline", false, "analyze without a luxsrv, e.g. to check --printBeats against a file on a machine without a strip")
 
 	var ledCount = flag.Int("leds", 0, "number of LEDs to be driven (max 255)")
 	var fftSize = flag.Int("fft", 1024, "FFT size")
+	var window = flag.String("window", "hann", "window function (rectangular, hann, hamming, blackman, blackman-harris, nuttall, flattop, kaiser)")
+	var kaiserBeta = flag.Float64("kaiserBeta", 8.6, "beta of the kaiser window, higher values leak less but widen the peaks")
+	var hopSize = flag.Int("hop", 0, "number of new samples per analysis, smaller than the FFT size for overlapping windows (default: the FFT size)")
+	var fps = flag.Float64("fps", 0, "target number of analyses per second, sets the hop size from the sample rate")
+
+	var maxFps = flag.Float64("maxFps", 0, "maximum number of frames sent per second, 0 sends every analyzed frame immediately")
+	var interpolate = flag.Bool("interpolate", false, "interpolate between analyzed frames when sending at maxFps")
 
-	var sampleRate = flag.Int("sampleRate", 0, "sample rate")
-	var channels = flag.Int("channels", 2, "number of channels")
+	var sampleRate = flag.Int("sampleRate", 0, "sample rate, detected from the audio device or WAV file if omitted")
+	var channels = flag.Int("channels", 0, "number of channels, detected from the audio device or WAV file if omitted")
 
 	var decay = flag.Float64("decay", 0.50, "decay factor [0,1] controls the smoothness of the visualization")
 	var dbfsThreshold = flag.Float64("dbfsThreshold", -GetSQNR(16), "dBFS threshold")
 
+	var filter = flag.String("filter", "", "filters applied before analysis, e.g. hp:30,lp:16000 (hp:freq[:q], lp:freq[:q], lowshelf:freq:gain[:q], highshelf:freq:gain[:q], peak:freq:gain[:q], preemphasis[:coef])")
+
+	var beatLow = flag.Float64("beatLow", 0, "lower frequency of the beat detection, e.g. 40 for the kick drum")
+	var beatHigh = flag.Float64("beatHigh", 0, "upper frequency of the beat detection, e.g. 150 for the kick drum, 0 for no limit")
+	var beatSensitivity = flag.Float64("beatSensitivity", 1.5, "how many standard deviations the spectral flux has to exceed its mean by to count as a beat")
+	var beatMinInterval = flag.Duration("beatMinInterval", 100*time.Millisecond, "minimum time between two beats")
+	var printBeats = flag.Bool("printBeats", false, "print the time, strength and tempo of every detected beat to stdout")
+	var tempoSync = flag.Bool("tempoSync", true, "lock animations like the rainbow to the tempo of the music while it is detected")
+
+	var agc = flag.Bool("agc", false, "automatically adjust the gain of the input, so that the visualization doesn't depend on the volume")
+	var agcTarget = flag.Float64("agcTarget", -20, "RMS level in dBFS that the AGC adjusts the input to")
+	var agcAttack = flag.Duration("agcAttack", 50*time.Millisecond, "how quickly the AGC reduces the gain when the input gets louder")
+	var agcRelease = flag.Duration("agcRelease", 2*time.Second, "how quickly the AGC increases the gain when the input gets quieter")
+	var agcMaxGain = flag.Float64("agcMaxGain", 30, "maximum gain of the AGC in dB")
+
 	var backend = flag.String("backend", "auto", "audio backend (auto, wasapi, alsa, pulse, jack)")
 	var device = flag.String("device", "loopback", "device to use (loopback, capture)")
+	var deviceId = flag.String("deviceId", "", "ID of the device to use instead of the default one (see the devices command)")
+	var deviceName = flag.String("deviceName", "", "name, or part of the name, of the device to use instead of the default one")
 
 	var audibleLow = flag.Float64("audibleLow", 20, "lower audible frequency")
 	var audibleHigh = flag.Float64("audibleHigh", 20000, "upper audible frequency")
 
+	var analyzer = flag.String("analyzer", "smart", "analyzer (smart, mel, cq, meter)")
+	var binsPerOctave = flag.Int("binsPerOctave", 12, "number of bins per octave of the cq analyzer, 12 for semitones")
+	var meter = flag.String("meter", "vu", "ballistics of the meter analyzer (vu, ppm, rms)")
+	var meterFloor = flag.Float64("meterFloor", -48, "level in dBFS at the bottom of the meter analyzer")
+	var redZone = flag.Float64("redZone", -6, "level in dBFS above which the meter analyzer shows redZoneColor")
+	var redZoneColor = flag.String("redZoneColor", "ff0000", "hex color of the red zone of the meter analyzer")
+	var melFilters = flag.Int("melFilters", 0, "number of filters of the mel analyzer (default: one per LED)")
+
+	var bands = flag.String("bands", "linear", "how the frequency range is divided between the LEDs (linear, log, mel, bark)")
 	var mirror = flag.Bool("mirror", false, "mirror mode with lower frequencies at the middle")
-	var effect = flag.String("effect", "solid", "color effect (solid, rainbow, luxception)")
+	var stereo = flag.Bool("stereo", false, "analyze the left and right channels separately, with lower frequencies at the middle")
+	var effect = flag.String("effect", "solid", "color effect (solid, rainbow, luxception, pulse)")
 
 	var color = flag.String("color", "ff00ff", "hex color")
 
+	var silenceThreshold = flag.Float64("silenceThreshold", -60, "dBFS level below which the input is considered silent")
+	var silenceHold = flag.Duration("silenceHold", 0, "how long the input has to be silent to switch to the idle effect, 0 disables it")
+	var idleEffect = flag.String("idleEffect", "off", "effect shown while the input is silent (off, breathing, ambient)")
+	var idleColor = flag.String("idleColor", "", "hex color of the idle effect (default: the same as color)")
+	var fadeTime = flag.Duration("fadeTime", 500*time.Millisecond, "duration of the fade between the idle and the audio-reactive effect")
+
+	var input = flag.String("input", "", "WAV file, FIFO or - for stdin to use as input instead of an audio device")
+	var format = flag.String("format", "", "sample format of the audio device, raw PCM or network input (u8, s16, s24, s32, f32), f32 by default and s16 for RTP")
+	var realtime = flag.Bool("realtime", true, "play file input in real time instead of as fast as possible")
+	var loop = flag.Bool("loop", false, "loop file input")
+
+	var listen = flag.String("listen", "", "UDP address to receive network audio on, e.g. :5004, instead of using an audio device")
+	var protocol = flag.String("protocol", "rtp", "protocol of network audio (rtp, udp)")
+	var jitterPackets = flag.Int("jitterPackets", 4, "number of RTP packets to buffer for reordering and loss concealment")
+
+	var record = flag.String("record", "", "WAV file to record the received audio to")
+	var recordDownmix = flag.Bool("recordDownmix", false, "also record the downmixed audio that is analyzed, to a .downmix.wav file")
+	var recordMaxSize = flag.Int64("recordMaxSize", 0, "size in MB after which a new recording is started, 0 for no limit")
+	var recordMaxDuration = flag.Duration("recordMaxDuration", 0, "duration after which a new recording is started, 0 for no limit")
+	var recordKeep = flag.Int("recordKeep", 5, "number of most recent recordings to keep, 0 keeps all")
+
+	var generator = flag.String("generator", "", "synthetic signal to use as input instead of an audio device (sine, sweep, white, pink, click)")
+	var generatorLevel = flag.Float64("generatorLevel", -6, "level of the generated signal in dBFS")
+	var generatorFreq = flag.Float64("generatorFreq", 1000, "frequency of the generated sine tone")
+	var generatorDuration = flag.Duration("generatorDuration", 10*time.Second, "duration of a generated sweep from audibleLow to audibleHigh")
+	var generatorClickRate = flag.Float64("generatorClickRate", 2, "generated clicks per second")
+
 	var verbose = flag.Bool("verbose", false, "print verbose messages")
 
+	flag.Usage = usage
+
+	if listDevices {
+		_ = flag.CommandLine.Parse(os.Args[2:])
+		return FlagsResult{
+			Backend:     *backend,
+			ListDevices: true,
+		}
+	}
+
 	flag.Parse()
 
-	if *host == "" || *ledCount == 0 || *ledCount > 255 || *sampleRate == 0 {
+	if (*host == "" && !*offline) || *ledCount == 0 || *ledCount > 255 {
 		flag.Usage()
 		os.Exit(2)
 	}
@@ -73,12 +216,51 @@ func GetFlags() FlagsResult {
 		os.Exit(2)
 	}
 
+	redZoneRgb, err := parseColor(*redZoneColor)
+	if err != nil {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	idleRgb := rgb
+	if *idleColor != "" {
+		idleRgb, err = parseColor(*idleColor)
+		if err != nil {
+			flag.Usage()
+			os.Exit(2)
+		}
+	}
+
 	return FlagsResult{
-		Host: *host,
-		Port: uint16(*port),
+		Host:    *host,
+		Port:    uint16(*port),
+		Offline: *offline,
 
 		LedCount: *ledCount,
 		FftSize:  *fftSize,
+		HopSize:  *hopSize,
+		Fps:      *fps,
+
+		Window:     *window,
+		KaiserBeta: *kaiserBeta,
+
+		MaxFps:      *maxFps,
+		Interpolate: *interpolate,
+
+		Filter: *filter,
+
+		BeatLow:         *beatLow,
+		BeatHigh:        *beatHigh,
+		BeatSensitivity: *beatSensitivity,
+		BeatMinInterval: *beatMinInterval,
+		PrintBeats:      *printBeats,
+		TempoSync:       *tempoSync,
+
+		Agc:        *agc,
+		AgcTarget:  *agcTarget,
+		AgcAttack:  *agcAttack,
+		AgcRelease: *agcRelease,
+		AgcMaxGain: *agcMaxGain,
 
 		SampleRate: *sampleRate,
 		Channels:   *channels,
@@ -86,21 +268,70 @@ func GetFlags() FlagsResult {
 		Decay:         *decay,
 		DbfsThreshold: *dbfsThreshold,
 
-		Backend: *backend,
-		Device:  *device,
+		Backend:    *backend,
+		Device:     *device,
+		DeviceId:   *deviceId,
+		DeviceName: *deviceName,
 
 		AudibleLow:  *audibleLow,
 		AudibleHigh: *audibleHigh,
 
+		Analyzer:   *analyzer,
+		MelFilters: *melFilters,
+
+		BinsPerOctave: *binsPerOctave,
+
+		Meter:        *meter,
+		MeterFloor:   *meterFloor,
+		RedZone:      *redZone,
+		RedZoneColor: redZoneRgb,
+
+		Bands:  *bands,
 		Mirror: *mirror,
+		Stereo: *stereo,
 		Effect: *effect,
 
 		Color: rgb,
 
+		SilenceThreshold: *silenceThreshold,
+		SilenceHold:      *silenceHold,
+		IdleEffect:       *idleEffect,
+		IdleColor:        idleRgb,
+		FadeTime:         *fadeTime,
+
+		Input:    *input,
+		Format:   *format,
+		Realtime: *realtime,
+		Loop:     *loop,
+
+		Listen:        *listen,
+		Protocol:      *protocol,
+		JitterPackets: *jitterPackets,
+
+		Record:            *record,
+		RecordDownmix:     *recordDownmix,
+		RecordMaxSize:     *recordMaxSize * 1024 * 1024,
+		RecordMaxDuration: *recordMaxDuration,
+		RecordKeep:        *recordKeep,
+
+		Generator:          *generator,
+		GeneratorLevel:     *generatorLevel,
+		GeneratorFreq:      *generatorFreq,
+		GeneratorDuration:  *generatorDuration,
+		GeneratorClickRate: *generatorClickRate,
+
 		Verbose: *verbose,
 	}
 }
 
+func usage() {
+	out := flag.CommandLine.Output()
+	_, _ = fmt.Fprintf(out, "Usage of %s:\n", os.Args[0])
+	_, _ = fmt.Fprintf(out, "  %s [flags]\n", os.Args[0])
+	_, _ = fmt.Fprintf(out, "  %s devices [-backend string]\n\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
 func parseColor(s string) (rgb color.RGBA, err error) {
 	c, err := strconv.ParseUint(s, 16, 24)
 
@@ -14,3 +14,19 @@ func CheckErr(err error) {
 func GetSQNR(bits int) float64 {
 	return 20 * math.Log10(math.Pow(2, float64(bits)))
 }
+
+// GetHannWindow returns a symmetric Hann window of the given size
+func GetHannWindow(size int) []float64 {
+	r := make([]float64, size)
+
+	if size == 1 {
+		r[0] = 1
+		return r
+	}
+
+	for n := range r {
+		r[n] = 0.5 * (1 - math.Cos(2*math.Pi*float64(n)/float64(size-1)))
+	}
+
+	return r
+}